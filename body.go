@@ -0,0 +1,212 @@
+package r2
+
+import (
+	"bytes"
+	"errors"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"reflect"
+	"sync"
+)
+
+// WithBodySpooling sets the threshold in bytes above which the request body is spooled to a temporary file
+// instead of being buffered in memory, in order to be re-sent.
+// The temporary file is removed when the iterator finishes.
+//
+// It applies only to the request body that can not be rewound by itself,
+// i.e. neither [io.ReaderAt] nor [io.Seeker] is implemented and [http.Request.GetBody] is not set.
+// If less than or equal to 0 is specified, the request body is always buffered in memory.
+func WithBodySpooling(threshold int64) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetSpoolThreshold(threshold)
+	}
+}
+
+// sizer is implemented by [bytes.Reader], [strings.Reader] and [io.SectionReader].
+type sizer interface {
+	Size() int64
+}
+
+// stater is implemented by [os.File].
+type stater interface {
+	Stat() (fs.FileInfo, error)
+}
+
+// bodySource returns the source of [http.Request.Body] to be rewound.
+// It is body if [http.Request.Body] is body itself or body wrapped by [io.NopCloser] as [http.NewRequest] does.
+// Otherwise, it is [http.Request.Body], since the request was created from another body.
+//
+// The returned bool reports whether [http.Request.ContentLength] can be set from the size of the source.
+// It is false for the wrapped body, so that the length decided by the request constructor is kept.
+func bodySource(req *http.Request, body io.Reader) (io.Reader, bool) {
+	if body != nil && reflect.TypeOf(body).Comparable() {
+		if rc, ok := body.(io.ReadCloser); ok && req.Body == rc {
+			return body, true
+		}
+		if req.Body == io.NopCloser(body) {
+			return body, false
+		}
+	}
+	return req.Body, true
+}
+
+// rewindBodyWithReaderAt returns an [internal.GetBodyFunc] that reads the body through [io.ReaderAt], and the size of the body.
+// Since the each returned body has its own offset, the previous attempt that is still reading does not affect the next one.
+// If the size is unknown, -1 is returned.
+func rewindBodyWithReaderAt(body io.ReaderAt) (internal.GetBodyFunc, int64, error) {
+	var start int64
+	if s, ok := body.(io.Seeker); ok {
+		offset, err := s.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, 0, err
+		}
+		start = offset
+	}
+
+	n, size := int64(math.MaxInt64)-start, int64(-1)
+	if total, ok := bodySize(body); ok {
+		n, size = total-start, total-start
+	}
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(body, start, n)), nil
+	}, size, nil
+}
+
+// rewindBodyWithSeeker returns an [internal.GetBodyFunc] that seeks the body to the offset at the first request,
+// and the size of the body.
+// Since the readers share the offset of the body, only the one returned last can be read,
+// so that the previous attempt that is still reading does not affect the next one.
+func rewindBodyWithSeeker(body io.ReadSeeker) (internal.GetBodyFunc, int64, error) {
+	start, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, 0, err
+	}
+	end, err := body.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, err
+	}
+	s := &seekerBody{body: body, start: start}
+	return s.rewind, end - start, nil
+}
+
+// errBodyRewound is returned when the request body is read after it is rewound for another attempt.
+var errBodyRewound = errors.New("r2: request body was rewound for another attempt")
+
+// seekerBody is [io.ReadSeeker] shared by the readers returned from rewind.
+type seekerBody struct {
+	mu         sync.Mutex
+	body       io.ReadSeeker
+	start      int64
+	generation uint64
+}
+
+// rewind seeks the body to the start, and returns the reader of the new generation.
+func (s *seekerBody) rewind() (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.body.Seek(s.start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	s.generation++
+	return &seekerBodyReader{body: s, generation: s.generation}, nil
+}
+
+// seekerBodyReader reads [seekerBody] while its generation is the latest.
+type seekerBodyReader struct {
+	body       *seekerBody
+	generation uint64
+}
+
+// Read implements [io.Reader].
+func (r *seekerBodyReader) Read(p []byte) (int, error) {
+	r.body.mu.Lock()
+	defer r.body.mu.Unlock()
+	if r.body.generation != r.generation {
+		return 0, errBodyRewound
+	}
+	return r.body.body.Read(p)
+}
+
+// Close does not close the body, so that it can be read again.
+func (r *seekerBodyReader) Close() error {
+	return nil
+}
+
+// spoolBody returns an [internal.GetBodyFunc] from the bytes if the body is smaller than or equal to the threshold.
+// Otherwise, it spools the body to a temporary file and returns an [internal.GetBodyFunc] from the file.
+func spoolBody(req *http.Request, threshold int64) (internal.GetBodyFunc, func(), error) {
+	head := bytes.Buffer{}
+	if _, err := io.CopyN(&head, req.Body, threshold+1); err != nil {
+		if err != io.EOF {
+			req.Body = io.NopCloser(&head)
+			return nil, noop, err
+		}
+		return getBodyFromBytes(head.Bytes()), noop, nil
+	}
+
+	f, err := os.CreateTemp("", "r2-body-*")
+	if err != nil {
+		req.Body = io.NopCloser(io.MultiReader(&head, req.Body))
+		return nil, noop, err
+	}
+	cleanup := func() {
+		f.Close()
+		os.Remove(f.Name())
+	}
+	n, err := io.Copy(f, io.MultiReader(&head, req.Body))
+	if err != nil {
+		req.Body = io.NopCloser(io.MultiReader(io.NewSectionReader(f, 0, n), req.Body))
+		return nil, cleanup, err
+	}
+	setContentLength(req, n)
+	return func() (io.ReadCloser, error) {
+		return io.NopCloser(io.NewSectionReader(f, 0, n)), nil
+	}, cleanup, nil
+}
+
+// bodySize returns the size of the body if it is known.
+func bodySize(body any) (int64, bool) {
+	switch b := body.(type) {
+	case sizer:
+		return b.Size(), true
+	case stater:
+		info, err := b.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		return info.Size(), true
+	}
+	return 0, false
+}
+
+// setContentLength sets [http.Request.ContentLength] if it is unknown.
+func setContentLength(req *http.Request, n int64) {
+	if req.ContentLength == 0 && n > 0 {
+		req.ContentLength = n
+	}
+}
+
+func noop() {
+	// no-op
+}
+
+// bufferResponseBody reads the response body, and replaces it with the one that can be read again.
+// It returns the copy of the response whose body can be read independently of the response.
+func bufferResponseBody(res *http.Response) (*http.Response, error) {
+	copiedRes := *res
+	if res.Body == nil || res.Body == http.NoBody {
+		return &copiedRes, nil
+	}
+	b, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	copiedRes.Body = io.NopCloser(bytes.NewReader(b))
+	return &copiedRes, nil
+}
@@ -0,0 +1,472 @@
+package r2
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry is the response stored in the HTTP cache.
+type CacheEntry = internal.CacheEntry
+
+// CacheStore is an abstraction of the storage of the HTTP cache.
+// It may be shared with the other iterators, so it must be safe for concurrent use.
+type CacheStore = internal.CacheStore
+
+// WithCache sets the storage of the HTTP cache conforming to RFC 9111 as the private cache.
+//
+// The response of GET is stored if it is cacheable by 'Cache-Control', 'Expires' and the validators,
+// and it is served without sending the request while it is fresh.
+// Once it is stale, every attempt is the conditional request with 'If-None-Match' and 'If-Modified-Since',
+// and 304(Not Modified) is replaced with the stored response.
+// The stored response is selected by 'Vary' header.
+// It is verified, decoded and classified in the same way as the response of the request,
+// and the fresh one retried by the classifier or [RetryAttempt] is revalidated with the conditional request.
+//
+// When every attempt fails, i.e. the iterator is terminated without the successful response
+// by the maximum number of requests, the context, 4xx(client error) or [Fail],
+// the stale response is served in place of the last failure
+// within the duration specified in 'stale-if-error' directive of the request or the stored response.
+// When the iterator is interrupted by the context while waiting for the next attempt, it is served after the failures.
+// The fresh stored response retried by the classifier counts toward the maximum number of requests.
+//
+// The successful response of the unsafe methods such as POST invalidates the stored response of the same url.
+func WithCache(store CacheStore) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetCacheStore(store)
+	}
+}
+
+// MemoryCacheStore is the [CacheStore] that keeps the entries in memory up to the limit in LRU order.
+type MemoryCacheStore struct {
+	maxEntries int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[string]*list.Element
+}
+
+// memoryCacheItem is the element of MemoryCacheStore.
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+}
+
+// NewMemoryCacheStore returns a new [MemoryCacheStore] that keeps up to maxEntries entries.
+// If maxEntries is less than or equal to 0, the number of the entries is not limited.
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get implements [CacheStore].
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.order.MoveToFront(e)
+	return e.Value.(*memoryCacheItem).entry, true
+}
+
+// Set implements [CacheStore].
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		e.Value.(*memoryCacheItem).entry = entry
+		s.order.MoveToFront(e)
+		return
+	}
+	s.items[key] = s.order.PushFront(&memoryCacheItem{key: key, entry: entry})
+	for s.maxEntries > 0 && s.order.Len() > s.maxEntries {
+		e := s.order.Back()
+		s.order.Remove(e)
+		delete(s.items, e.Value.(*memoryCacheItem).key)
+	}
+}
+
+// Delete implements [CacheStore].
+func (s *MemoryCacheStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.items[key]; ok {
+		s.order.Remove(e)
+		delete(s.items, key)
+	}
+}
+
+// DiskCacheStore is the [CacheStore] that keeps each entry in the file of the directory.
+// Since the cache is the best effort, the failure of the file system is regarded as the cache miss.
+type DiskCacheStore struct {
+	dir string
+}
+
+// NewDiskCacheStore returns a new [DiskCacheStore] that keeps the entries in dir.
+// dir is created if it does not exist.
+func NewDiskCacheStore(dir string) *DiskCacheStore {
+	return &DiskCacheStore{dir: dir}
+}
+
+// Get implements [CacheStore].
+func (s *DiskCacheStore) Get(key string) (*CacheEntry, bool) {
+	f, err := os.Open(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	var stored diskCacheEntry
+	if err := gob.NewDecoder(f).Decode(&stored); err != nil || stored.Key != key {
+		return nil, false
+	}
+	return &stored.Entry, true
+}
+
+// Set implements [CacheStore].
+func (s *DiskCacheStore) Set(key string, entry *CacheEntry) {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(s.dir, ".*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+	err = gob.NewEncoder(tmp).Encode(diskCacheEntry{Key: key, Entry: *entry})
+	if closeErr := tmp.Close(); err != nil || closeErr != nil {
+		return
+	}
+	os.Rename(tmp.Name(), s.path(key))
+}
+
+// Delete implements [CacheStore].
+func (s *DiskCacheStore) Delete(key string) {
+	os.Remove(s.path(key))
+}
+
+// path returns the path of the file of key.
+func (s *DiskCacheStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// diskCacheEntry is the content of the file of DiskCacheStore.
+type diskCacheEntry struct {
+	Key   string
+	Entry CacheEntry
+}
+
+// cacheableStatusCodes is the status codes that are cacheable by default.
+var cacheableStatusCodes = []int{
+	http.StatusOK,
+	http.StatusNonAuthoritativeInfo,
+	http.StatusNoContent,
+	http.StatusMultipleChoices,
+	http.StatusMovedPermanently,
+	http.StatusPermanentRedirect,
+	http.StatusNotFound,
+	http.StatusMethodNotAllowed,
+	http.StatusGone,
+	http.StatusRequestURITooLong,
+	http.StatusNotImplemented,
+}
+
+// responseCache is the HTTP cache for the requests of the iterator.
+type responseCache struct {
+	store       CacheStore
+	key         string
+	entry       *CacheEntry
+	noStore     bool
+	requestTime time.Time
+}
+
+// newResponseCache returns the responseCache, or nil if the cache is not specified.
+func newResponseCache(prop internal.R2Prop) *responseCache {
+	store := prop.CacheStore()
+	if store == nil {
+		return nil
+	}
+	return &responseCache{store: store}
+}
+
+// lookup looks up the stored response of the request, and returns it if it is fresh.
+func (c *responseCache) lookup(req *http.Request) *http.Response {
+	if req.Method != http.MethodGet {
+		return nil
+	}
+	c.key = cacheKey(req)
+	directives := cacheControl(req.Header)
+	if _, ok := directives["no-store"]; ok {
+		c.noStore = true
+		return nil
+	}
+	entry, ok := c.store.Get(c.key)
+	if !ok || !varyMatches(entry, req) {
+		return nil
+	}
+	c.entry = entry
+	if _, ok := directives["no-cache"]; ok || req.Header.Get("Pragma") == "no-cache" {
+		return nil
+	}
+	if _, ok := cacheControl(entry.Header)["no-cache"]; ok {
+		return nil
+	}
+	now := time.Now()
+	lifetime := freshnessLifetime(entry)
+	if maxAge, ok := directiveSeconds(directives, "max-age"); ok {
+		lifetime = min(lifetime, maxAge)
+	}
+	if currentAge(entry, now) >= lifetime {
+		return nil
+	}
+	return cachedResponse(req, entry, now)
+}
+
+// prepare makes the request conditional if the stale response is stored.
+func (c *responseCache) prepare(req *http.Request) {
+	c.requestTime = time.Now()
+	if c.entry == nil {
+		return
+	}
+	cloneHeader(req)
+	if etag := c.entry.Header.Get("ETag"); etag != "" && req.Header.Get("If-None-Match") == "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	if lastModified := c.entry.Header.Get("Last-Modified"); lastModified != "" && req.Header.Get("If-Modified-Since") == "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+	}
+}
+
+// update stores the response if it is cacheable, and returns the response to be yielded.
+// 304(Not Modified) is replaced with the stored response.
+func (c *responseCache) update(req *http.Request, res *http.Response) *http.Response {
+	if req.Method != http.MethodGet {
+		if req.Method != http.MethodHead && req.Method != http.MethodOptions && req.Method != http.MethodTrace &&
+			res.StatusCode < http.StatusBadRequest {
+			c.store.Delete(cacheKey(req))
+		}
+		return res
+	}
+	if c.noStore {
+		return res
+	}
+	now := time.Now()
+	if res.StatusCode == http.StatusNotModified && c.entry != nil {
+		if res.Body != nil {
+			res.Body.Close()
+		}
+		updated := *c.entry
+		updated.Header = c.entry.Header.Clone()
+		for k, v := range res.Header {
+			if k == "Content-Length" {
+				continue
+			}
+			updated.Header[k] = slices.Clone(v)
+		}
+		updated.RequestTime, updated.ResponseTime = c.requestTime, now
+		c.entry = &updated
+		c.store.Set(c.key, c.entry)
+		return cachedResponse(req, c.entry, now)
+	}
+	if !cacheable(res) {
+		return res
+	}
+	var body []byte
+	if res.Body != nil && res.Body != http.NoBody {
+		b, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			// the body is broken, so that the error is propagated to the consumer.
+			res.Body = io.NopCloser(io.MultiReader(bytes.NewReader(b), &errReader{err: err}))
+			return res
+		}
+		res.Body = io.NopCloser(bytes.NewReader(b))
+		body = b
+	}
+	c.entry = &CacheEntry{
+		StatusCode:   res.StatusCode,
+		Header:       res.Header.Clone(),
+		Body:         body,
+		RequestTime:  c.requestTime,
+		ResponseTime: now,
+		VaryHeader:   varyHeader(res, req),
+	}
+	c.store.Set(c.key, c.entry)
+	return res
+}
+
+// staleIfError returns the stale response if it is allowed to be served on error.
+func (c *responseCache) staleIfError(req *http.Request) *http.Response {
+	if c.entry == nil {
+		return nil
+	}
+	responseDirectives := cacheControl(c.entry.Header)
+	if _, ok := responseDirectives["must-revalidate"]; ok {
+		return nil
+	}
+	window, ok := directiveSeconds(cacheControl(req.Header), "stale-if-error")
+	if !ok {
+		window, ok = directiveSeconds(responseDirectives, "stale-if-error")
+	}
+	now := time.Now()
+	if !ok || currentAge(c.entry, now) > freshnessLifetime(c.entry)+window {
+		return nil
+	}
+	return cachedResponse(req, c.entry, now)
+}
+
+// cacheKey returns the key of the stored response of the request.
+func cacheKey(req *http.Request) string {
+	return http.MethodGet + " " + req.URL.String()
+}
+
+// cacheable reports whether the response can be stored.
+func cacheable(res *http.Response) bool {
+	if !slices.Contains(cacheableStatusCodes, res.StatusCode) || res.Header.Get("Vary") == "*" {
+		return false
+	}
+	directives := cacheControl(res.Header)
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if _, ok := directives["max-age"]; ok {
+		return true
+	}
+	for _, key := range []string{"Expires", "ETag", "Last-Modified"} {
+		if res.Header.Get(key) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl parses 'Cache-Control' header into the directives.
+func cacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name == "" {
+				continue
+			}
+			directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+// directiveSeconds returns the duration of the directive in seconds.
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	arg, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+// responseDate returns 'Date' header of the stored response, or the time when it is received.
+func responseDate(entry *CacheEntry) time.Time {
+	if date, err := http.ParseTime(entry.Header.Get("Date")); err == nil {
+		return date
+	}
+	return entry.ResponseTime
+}
+
+// freshnessLifetime returns the freshness lifetime of the stored response.
+func freshnessLifetime(entry *CacheEntry) time.Duration {
+	if maxAge, ok := directiveSeconds(cacheControl(entry.Header), "max-age"); ok {
+		return maxAge
+	}
+	if expires := entry.Header.Get("Expires"); expires != "" {
+		t, err := http.ParseTime(expires)
+		if err != nil {
+			// the invalid date means already expired.
+			return 0
+		}
+		return max(t.Sub(responseDate(entry)), 0)
+	}
+	if lastModified, err := http.ParseTime(entry.Header.Get("Last-Modified")); err == nil {
+		// the heuristic freshness is 10% of the time since the last modification.
+		return max(responseDate(entry).Sub(lastModified)/10, 0)
+	}
+	return 0
+}
+
+// currentAge returns the current age of the stored response.
+func currentAge(entry *CacheEntry, now time.Time) time.Duration {
+	apparentAge := max(entry.ResponseTime.Sub(responseDate(entry)), 0)
+	ageValue, _ := strconv.ParseInt(entry.Header.Get("Age"), 10, 64)
+	correctedAge := time.Duration(ageValue)*time.Second + entry.ResponseTime.Sub(entry.RequestTime)
+	return max(apparentAge, correctedAge) + now.Sub(entry.ResponseTime)
+}
+
+// varyHeader returns the request header nominated by 'Vary' header of the response.
+func varyHeader(res *http.Response, req *http.Request) http.Header {
+	header := http.Header{}
+	for _, value := range res.Header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				header[http.CanonicalHeaderKey(name)] = slices.Clone(req.Header.Values(name))
+			}
+		}
+	}
+	return header
+}
+
+// varyMatches reports whether the request matches the request header nominated by 'Vary' header of the stored response.
+func varyMatches(entry *CacheEntry, req *http.Request) bool {
+	for name, values := range entry.VaryHeader {
+		if strings.Join(values, ",") != strings.Join(req.Header.Values(name), ",") {
+			return false
+		}
+	}
+	return true
+}
+
+// cachedResponse returns the response of the stored entry.
+func cachedResponse(req *http.Request, entry *CacheEntry, now time.Time) *http.Response {
+	header := entry.Header.Clone()
+	header.Set("Age", strconv.FormatInt(int64(currentAge(entry, now)/time.Second), 10))
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", entry.StatusCode, http.StatusText(entry.StatusCode)),
+		StatusCode:    entry.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(entry.Body)),
+		ContentLength: int64(len(entry.Body)),
+		Request:       req,
+	}
+}
+
+// errReader returns err.
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(_ []byte) (int, error) {
+	return 0, r.err
+}
@@ -0,0 +1,205 @@
+package r2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrRangeNotSupported is returned when the server does not support 'Range' requests.
+var ErrRangeNotSupported = errors.New("r2: range requests are not supported")
+
+// ErrResourceChanged is returned when the resource is changed during the download.
+var ErrResourceChanged = errors.New("r2: resource changed during the download")
+
+// ProgressFunc reports the number of bytes done and the total.
+// It is not called concurrently.
+type ProgressFunc = internal.ProgressFunc
+
+// WithChunks sets the number of the chunks that [DownloadChunks] splits the resource into.
+// Default: 4
+func WithChunks(chunks int) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetChunks(chunks)
+	}
+}
+
+// WithConcurrency sets the maximum number of the chunks that [DownloadChunks] downloads concurrently.
+// Default: the number of the chunks
+func WithConcurrency(concurrency int) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetConcurrency(concurrency)
+	}
+}
+
+// WithProgress sets the function that reports the aggregate progress of [DownloadChunks].
+// It is called every time any chunk is written.
+func WithProgress(progress ProgressFunc) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetProgress(progress)
+	}
+}
+
+// DownloadChunks downloads the resource of url to dst in parallel, and returns the number of the bytes written.
+//
+// The size of the resource is probed with HEAD same as [Head], and the resource is split into the chunks specified in [WithChunks].
+// Each chunk is requested with 'Range' concurrently up to the limit specified in [WithConcurrency],
+// and written to dst at its offset with [io.WriterAt].
+//
+// Each chunk is retried same as [Get] by itself.
+// When the connection drops in the middle of the chunk, only the rest of the chunk is requested again.
+// If the chunk is not completed in the end, the other chunks are canceled and the error is returned.
+//
+// If the server does not support 'Range', [ErrRangeNotSupported] is returned.
+// If the resource is changed during the download, [ErrResourceChanged] is returned.
+func DownloadChunks(ctx context.Context, url string, dst io.WriterAt, options ...internal.Option) (int64, error) {
+	prop := internal.NewR2Prop(options...)
+	options = append(slices.Clip(options), WithAutoCloseResponseBody(false))
+
+	res, err := connectStream(ctx, func(_ int) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	}, options...)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+	total := res.ContentLength
+	if total < 0 || res.Header.Get("Accept-Ranges") != "bytes" {
+		return 0, ErrRangeNotSupported
+	}
+	validator := resumeValidator(res)
+
+	chunks := int64(prop.Chunks())
+	chunkSize := max((total+chunks-1)/chunks, 1)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	var (
+		wg       sync.WaitGroup
+		done     int64
+		mu       sync.Mutex
+		progress = prop.Progress()
+	)
+	// the running total is computed under the same lock as the progress, so the progress never goes backwards.
+	report := func(n int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		done += n
+		if progress != nil {
+			progress(done, total)
+		}
+	}
+	semaphore := make(chan struct{}, prop.Concurrency())
+	for start := int64(0); start < total; start += chunkSize {
+		end := min(start+chunkSize, total) - 1
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			if err := downloadChunk(ctx, prop, url, validator, start, end, dst, report, options...); err != nil {
+				cancel(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := context.Cause(ctx); err != nil {
+		return done, err
+	}
+	return done, nil
+}
+
+// downloadChunk downloads the range from start to end of the resource, and writes it to dst.
+func downloadChunk(ctx context.Context, prop internal.R2Prop, url, validator string, start, end int64, dst io.WriterAt, report func(int64), options ...internal.Option) error {
+	offset := start
+	for resumes := 0; ; {
+		from := offset
+		newRequest := func(_ int) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", from, end))
+			if validator != "" {
+				req.Header.Set("If-Range", validator)
+			}
+			return req, nil
+		}
+		res, err := connectStream(ctx, newRequest, options...)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode != http.StatusPartialContent {
+			res.Body.Close()
+			// the server ignores 'Range' or 'If-Range' is not satisfied.
+			return fmt.Errorf("%w: %s", ErrResourceChanged, res.Status)
+		}
+		if contentRangeStart(res) != from {
+			res.Body.Close()
+			return fmt.Errorf("%w: content-range: %s", ErrUnexpectedStatusCode, res.Header.Get("Content-Range"))
+		}
+
+		w := &progressWriter{w: io.NewOffsetWriter(dst, from), report: report}
+		n, err := io.Copy(w, io.LimitReader(res.Body, end-from+1))
+		res.Body.Close()
+		offset += n
+		if err == nil && offset > end {
+			return nil
+		}
+		if err == nil {
+			err = io.ErrUnexpectedEOF
+		}
+
+		if n > 0 {
+			resumes = 0
+		}
+		resumes++
+		if ctx.Err() != nil || (prop.MaxRequestTimes() != 0 && resumes > prop.MaxRequestTimes()) {
+			return err
+		}
+		slog.Default().WarnContext(
+			ctx,
+			"[r2]: chunk download dropped.",
+			slog.String("url", url),
+			slog.Int64("offset", offset),
+			slog.Int64("end", end),
+			slog.Any("error", err))
+		wait := prop.Interval()
+		if wait == 0 {
+			wait = backOff(resumes - 1)
+		}
+		select {
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		case <-time.After(wait):
+			// no-op
+		}
+	}
+}
+
+// progressWriter reports the number of bytes written.
+type progressWriter struct {
+	w      io.Writer
+	report func(int64)
+}
+
+func (w *progressWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	if n > 0 {
+		w.report(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,97 @@
+package r2
+
+import (
+	"github.com/miyamo2/r2/internal"
+	"net/http"
+	"time"
+)
+
+// Decision specifies what the iterator does after the response is yielded.
+// It is returned by the [Classifier] with [Default], [Stop], [Retry], [RetryAfter] or [Fail].
+type Decision = internal.Decision
+
+// Attempt is the information of the attempt that is classified.
+type Attempt = internal.Attempt
+
+// Classifier classifies the response and error of the attempt into the [Decision].
+// The response is nil if the request failed.
+type Classifier = internal.Classifier
+
+// Default returns the [Decision] that follows the built-in rules.
+//   - the response status code is less than 400: stop.
+//   - the response status code is 429(Too Many Request): retry conforming to 'Retry-After' header.
+//   - the response status code is other 4xx(client error): stop.
+//   - the response status code is 5xx(server error) or the request failed: retry.
+func Default() Decision {
+	return Decision{Action: internal.ActionDefault}
+}
+
+// Stop returns the [Decision] that terminates the iterator.
+func Stop() Decision {
+	return Decision{Action: internal.ActionStop}
+}
+
+// Retry returns the [Decision] that sends the next request even if the response is successful or 4xx(client error).
+// The interval until the next request is the same as the built-in rules.
+func Retry() Decision {
+	return Decision{Action: internal.ActionRetry}
+}
+
+// RetryAfter returns the [Decision] that sends the next request after wait.
+// The interval specified in [WithInterval] and 'Retry-After' header are ignored.
+func RetryAfter(wait time.Duration) Decision {
+	return Decision{Action: internal.ActionRetryAfter, Wait: wait}
+}
+
+// Fail returns the [Decision] that terminates the iterator, and yields err instead of the error of the attempt.
+func Fail(err error) Decision {
+	return Decision{Action: internal.ActionFail, Err: err}
+}
+
+// WithClassifier sets the classifier that decides whether the iterator stops or retries after each attempt.
+// The decision takes precedence over the built-in rules. See also [Default].
+//
+// The maximum number of requests specified in [WithMaxRequestAttempts] and the context are still applied.
+// It replaces the termination condition specified in [WithTerminateIf].
+func WithClassifier(classifier Classifier) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetClassifier(classifier)
+	}
+}
+
+// terminateIf returns the [Classifier] that stops when the termination condition is satisfied.
+// If not satisfied, the successful response is retried and the others follow the built-in rules.
+func terminateIf(cond TerminationCondition) Classifier {
+	return func(res *http.Response, err error, _ Attempt) Decision {
+		if res == nil || res.StatusCode == http.StatusTooManyRequests {
+			return Default()
+		}
+		if cond(res, err) {
+			return Stop()
+		}
+		if res.StatusCode < http.StatusBadRequest {
+			return Retry()
+		}
+		return Default()
+	}
+}
+
+// WithPeekLimit sets the maximum number of bytes of the response body that the classifier reads.
+// The classifier receives only the leading limit bytes of the body,
+// and the response body yielded to the consumer replays them followed by the rest of the body that has not been read yet.
+//
+// If limit is less than or equal to 0, the whole response body is read before the classification. It is the default.
+func WithPeekLimit(limit int64) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetPeekLimit(limit)
+	}
+}
+
+// WithHeaderOnlyInspection sets whether the classifier inspects only the status and header of the response.
+// If true, the classifier receives the response with [http.NoBody], and the response body is never read before it is yielded.
+// Default: false
+func WithHeaderOnlyInspection(headerOnly bool) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetHeaderOnlyInspection(headerOnly)
+	}
+}
@@ -0,0 +1,185 @@
+package r2
+
+import (
+	"bytes"
+	"context"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// WithCoalescing enables the coalescing of the identical GET and HEAD requests in flight.
+//
+// The requests are identical if the method, the url and the values of headers are the same.
+// 'Authorization', 'Cookie' and 'Proxy-Authorization' always distinguish the requests even if they are not in headers.
+// The identical iterations that run concurrently share one underlying sequence of the attempts,
+// and each of them receives every attempt with its own copy of the response whose body is buffered in memory.
+// The iteration that joins later receives the attempts sent so far first.
+// The shared sequence is canceled when every iteration sharing it is interrupted.
+//
+// The options of the iteration that starts the flight apply to every iteration sharing it,
+// so that the options of the iterations joining later, such as the classifier, the maximum number of requests
+// and the client, are ignored.
+//
+// Since the credential set by [WithCredentialProvider], [WithKeyPool] or [WithMessageSignature] is not a part of
+// the identity of the request, the request is not coalesced if any of them is specified.
+//
+// Since the response is the copy, [RetryAttempt] is not available for it.
+func WithCoalescing(headers ...string) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetCoalescing(true, headers)
+	}
+}
+
+// flights is the sequences of the attempts in flight, keyed by coalescingKey.
+var (
+	flightsMu sync.Mutex
+	flights   = map[string]*flight{}
+)
+
+// flight is the sequence of the attempts shared by the identical iterations.
+type flight struct {
+	mu          sync.Mutex
+	events      []flightEvent
+	done        bool
+	notify      chan struct{}
+	subscribers int
+	cancel      context.CancelFunc
+}
+
+// flightEvent is the attempt of the flight.
+type flightEvent struct {
+	res  *http.Response
+	body []byte
+	err  error
+}
+
+// credentialHeaders is the headers that always distinguish the coalesced requests,
+// so that the response for a credential is never shared with the other one.
+var credentialHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization"}
+
+// coalescingKey returns the key of the request to coalesce, or false if the request is not coalesced.
+func coalescingKey(prop internal.R2Prop, req *http.Request) (string, bool) {
+	coalescing, headers := prop.Coalescing()
+	if !coalescing || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+		return "", false
+	}
+	// the credential is added to the request later, so the iterations with it can not be told apart.
+	if prop.CredentialProvider() != nil || prop.KeyPool() != nil || prop.MessageSignature() != nil {
+		return "", false
+	}
+	var key strings.Builder
+	key.WriteString(req.Method + " " + req.URL.String())
+	for _, name := range append(slices.Clip(credentialHeaders), headers...) {
+		key.WriteString("\n" + http.CanonicalHeaderKey(name) + ": " + strings.Join(req.Header.Values(name), ","))
+	}
+	return key.String(), true
+}
+
+// coalesce yields the attempts of the flight of key. If no flight of key is running, it starts the new one with run.
+func coalesce(ctx context.Context, key string, run func(ctx context.Context, yield func(*http.Response, error) bool), autoClose bool, yield func(*http.Response, error) bool) {
+	f := joinFlight(ctx, key, run)
+	defer leaveFlight(key, f)
+	for i := 0; ; i++ {
+		f.mu.Lock()
+		for i >= len(f.events) && !f.done {
+			notify := f.notify
+			f.mu.Unlock()
+			select {
+			case <-ctx.Done():
+				return
+			case <-notify:
+				// no-op
+			}
+			f.mu.Lock()
+		}
+		if i >= len(f.events) {
+			f.mu.Unlock()
+			return
+		}
+		event := f.events[i]
+		f.mu.Unlock()
+
+		var res *http.Response
+		if event.res != nil {
+			copied := *event.res
+			copied.Header = event.res.Header.Clone()
+			copied.Body = io.NopCloser(bytes.NewReader(event.body))
+			res = &copied
+		}
+		if !yieldWithAutoClose(res, event.err, autoClose, yield) {
+			return
+		}
+	}
+}
+
+// joinFlight returns the running flight of key, or starts the new one with run.
+func joinFlight(ctx context.Context, key string, run func(ctx context.Context, yield func(*http.Response, error) bool)) *flight {
+	flightsMu.Lock()
+	defer flightsMu.Unlock()
+	if f, ok := flights[key]; ok {
+		f.mu.Lock()
+		f.subscribers++
+		f.mu.Unlock()
+		return f
+	}
+	// the flight is not canceled by the context of the iteration that starts it, but by leaving of every iteration.
+	flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	f := &flight{notify: make(chan struct{}), subscribers: 1, cancel: cancel}
+	flights[key] = f
+	go func() {
+		defer cancel()
+		run(flightCtx, func(res *http.Response, err error) bool {
+			event := flightEvent{res: res, err: err}
+			if res != nil && res.Body != nil {
+				event.body, event.err = io.ReadAll(res.Body)
+				res.Body.Close()
+				if event.err == nil {
+					event.err = err
+				}
+			}
+			f.publish(event, false)
+			return flightCtx.Err() == nil
+		})
+		flightsMu.Lock()
+		if flights[key] == f {
+			delete(flights, key)
+		}
+		flightsMu.Unlock()
+		f.publish(flightEvent{}, true)
+	}()
+	return f
+}
+
+// leaveFlight removes the iteration from the flight, and cancels the flight if no iteration remains.
+func leaveFlight(key string, f *flight) {
+	flightsMu.Lock()
+	defer flightsMu.Unlock()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subscribers--
+	if f.subscribers > 0 || f.done {
+		return
+	}
+	f.cancel()
+	if flights[key] == f {
+		// the canceled flight is not joined anymore.
+		delete(flights, key)
+	}
+}
+
+// publish appends the event, or marks the flight as done, and notifies the iterations.
+func (f *flight) publish(event flightEvent, done bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if done {
+		f.done = true
+	} else {
+		f.events = append(f.events, event)
+	}
+	close(f.notify)
+	f.notify = make(chan struct{})
+}
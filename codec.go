@@ -0,0 +1,185 @@
+package r2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"iter"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Codec specifies the interface for encoding the request body and decoding the response body.
+type Codec interface {
+	// Marshal returns the encoding of v.
+	Marshal(v any) ([]byte, error)
+	// Unmarshal parses the encoded data and stores the result in the value pointed to by v.
+	Unmarshal(data []byte, v any) error
+}
+
+// ErrUnsupportedContentType is returned when there is no codec for the content type.
+var ErrUnsupportedContentType = errors.New("r2: unsupported content type")
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		ContentTypeApplicationJSON:           jsonCodec{},
+		ContentTypeApplicationXML:            xmlCodec{},
+		"text/xml":                           xmlCodec{},
+		ContentTypeApplicationFormURLEncoded: formCodec{},
+	}
+)
+
+// RegisterCodec registers the codec for the content type such as [ContentTypeApplicationMsgPack].
+// If the codec for the content type is already registered, it is replaced.
+//
+// By default, codecs for [ContentTypeApplicationJSON], [ContentTypeApplicationXML]
+// and [ContentTypeApplicationFormURLEncoded] are registered.
+func RegisterCodec(contentType string, codec Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[strings.ToLower(contentType)] = codec
+}
+
+// lookupCodec returns the codec registered for the media type of the content type.
+// If no codec is registered for the media type, the structured syntax suffix such as '+json' is considered.
+func lookupCodec(contentType string) (Codec, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnsupportedContentType, err)
+	}
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	if codec, ok := codecs[mediaType]; ok {
+		return codec, nil
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		if codec, ok := codecs[ContentTypeApplicationJSON]; ok {
+			return codec, nil
+		}
+	case strings.HasSuffix(mediaType, "+xml"):
+		if codec, ok := codecs[ContentTypeApplicationXML]; ok {
+			return codec, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: '%s'", ErrUnsupportedContentType, mediaType)
+}
+
+// PostValue sends HTTP POST requests same as [Post], with the body encoded from v.
+// v is encoded only once by the codec registered for the content type specified in [WithContentType],
+// and the encoded body is re-sent on every attempt.
+// If the content type is not specified, [ContentTypeApplicationJSON] is used.
+func PostValue(ctx context.Context, url string, v any, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	return doValue(ctx, url, http.MethodPost, v, options...)
+}
+
+// PutValue sends HTTP PUT requests same as [Put], with the body encoded from v.
+// v is encoded only once by the codec registered for the content type specified in [WithContentType],
+// and the encoded body is re-sent on every attempt.
+// If the content type is not specified, [ContentTypeApplicationJSON] is used.
+func PutValue(ctx context.Context, url string, v any, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	return doValue(ctx, url, http.MethodPut, v, options...)
+}
+
+// PatchValue sends HTTP PATCH requests same as [Patch], with the body encoded from v.
+// v is encoded only once by the codec registered for the content type specified in [WithContentType],
+// and the encoded body is re-sent on every attempt.
+// If the content type is not specified, [ContentTypeApplicationJSON] is used.
+func PatchValue(ctx context.Context, url string, v any, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	return doValue(ctx, url, http.MethodPatch, v, options...)
+}
+
+// doValue sends HTTP requests with the body encoded from v.
+// If v could not be encoded, the error is yielded without sending the request.
+func doValue(ctx context.Context, url, method string, v any, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	prop := internal.NewR2Prop(options...)
+	contentType := prop.ContentType()
+	if contentType == "" {
+		contentType = ContentTypeApplicationJSON
+		options = append(options, WithContentType(contentType))
+	}
+	codec, err := lookupCodec(contentType)
+	if err != nil {
+		return errSeq(err)
+	}
+	b, err := codec.Marshal(v)
+	if err != nil {
+		return errSeq(fmt.Errorf("r2: failed to encode the request body as '%s': %w", contentType, err))
+	}
+	return Do(ctx, url, method, bytes.NewReader(b), options...)
+}
+
+// errSeq returns the iterator that yields only the error.
+func errSeq(err error) iter.Seq2[*http.Response, error] {
+	return func(yield func(*http.Response, error) bool) {
+		yield(nil, err)
+	}
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	return json.Unmarshal(data, v)
+}
+
+type xmlCodec struct{}
+
+func (xmlCodec) Marshal(v any) ([]byte, error) {
+	return xml.Marshal(v)
+}
+
+func (xmlCodec) Unmarshal(data []byte, v any) error {
+	return xml.Unmarshal(data, v)
+}
+
+// formCodec encodes and decodes [url.Values], map[string][]string and map[string]string.
+type formCodec struct{}
+
+func (formCodec) Marshal(v any) ([]byte, error) {
+	switch form := v.(type) {
+	case url.Values:
+		return []byte(form.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(form).Encode()), nil
+	case map[string]string:
+		values := make(url.Values, len(form))
+		for k, v := range form {
+			values.Set(k, v)
+		}
+		return []byte(values.Encode()), nil
+	}
+	return nil, fmt.Errorf("r2: form codec does not support %T", v)
+}
+
+func (formCodec) Unmarshal(data []byte, v any) error {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return err
+	}
+	switch form := v.(type) {
+	case *url.Values:
+		*form = values
+	case *map[string][]string:
+		*form = values
+	case *map[string]string:
+		*form = make(map[string]string, len(values))
+		for k := range values {
+			(*form)[k] = values.Get(k)
+		}
+	default:
+		return fmt.Errorf("r2: form codec does not support %T", v)
+	}
+	return nil
+}
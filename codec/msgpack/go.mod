@@ -0,0 +1,14 @@
+module github.com/miyamo2/r2/codec/msgpack
+
+go 1.22
+
+// The local copy is used until r2 v0.4.0, the release including RegisterCodec, is tagged.
+// Since replace directives are ignored in the dependencies, the requirement must be bumped to v0.4.0 then.
+replace github.com/miyamo2/r2 => ../../
+
+require (
+	github.com/miyamo2/r2 v0.0.0-00010101000000-000000000000
+	github.com/vmihailenco/msgpack/v5 v5.4.1
+)
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
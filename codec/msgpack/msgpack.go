@@ -0,0 +1,28 @@
+// Package msgpack provides the [r2.Codec] for [r2.ContentTypeApplicationMsgPack].
+//
+// It is registered by importing this package for side effects.
+//
+//	import _ "github.com/miyamo2/r2/codec/msgpack"
+package msgpack
+
+import (
+	"github.com/miyamo2/r2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func init() {
+	r2.RegisterCodec(r2.ContentTypeApplicationMsgPack, Codec{})
+}
+
+// Codec is the [r2.Codec] for MessagePack.
+type Codec struct{}
+
+// Marshal returns the MessagePack encoding of v.
+func (Codec) Marshal(v any) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+// Unmarshal parses the MessagePack encoded data and stores the result in the value pointed to by v.
+func (Codec) Unmarshal(data []byte, v any) error {
+	return msgpack.Unmarshal(data, v)
+}
@@ -0,0 +1,240 @@
+package r2
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credential sets the credential to the request header.
+type Credential = internal.Credential
+
+// CredentialProvider specifies the interface for the provider of the credential that is consulted before every request.
+type CredentialProvider = internal.CredentialProvider
+
+// CredentialProviderFunc is an adapter to allow the use of ordinary functions as [CredentialProvider].
+type CredentialProviderFunc func(req *http.Request) (Credential, error)
+
+// Credential calls f(req).
+func (f CredentialProviderFunc) Credential(req *http.Request) (Credential, error) {
+	return f(req)
+}
+
+// WithCredentialProvider sets the provider of the credential that is consulted before every request.
+// So that rotated secrets are applied from the next request.
+func WithCredentialProvider(credentialProvider CredentialProvider) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetCredentialProvider(credentialProvider)
+	}
+}
+
+// BasicAuth returns a [Credential] that sets the 'Authorization' header with the Basic scheme.
+func BasicAuth(username, password string) Credential {
+	return func(header http.Header) {
+		r := http.Request{Header: header}
+		r.SetBasicAuth(username, password)
+	}
+}
+
+// BearerToken returns a [Credential] that sets the 'Authorization' header with the Bearer scheme.
+func BearerToken(token string) Credential {
+	return func(header http.Header) {
+		header.Set("Authorization", "Bearer "+token)
+	}
+}
+
+// HeaderValue returns a [Credential] that sets the given header.
+func HeaderValue(key, value string) Credential {
+	return func(header http.Header) {
+		header.Set(key, value)
+	}
+}
+
+// NewEnvCredentialProvider returns a [CredentialProvider] that reads the secret from the environment variable on every request.
+// The secret is converted to the [Credential] by the credential function such as [BearerToken].
+func NewEnvCredentialProvider(key string, credential func(secret string) Credential) CredentialProvider {
+	return CredentialProviderFunc(func(_ *http.Request) (Credential, error) {
+		secret, ok := os.LookupEnv(key)
+		if !ok {
+			return nil, fmt.Errorf("r2: environment variable '%s' is not set", key)
+		}
+		return credential(secret), nil
+	})
+}
+
+// NewFileCredentialProvider returns a [CredentialProvider] that reads the secret from the file.
+// The file is re-read when its modification time changes, such as Kubernetes mounted secrets.
+// The secret is converted to the [Credential] by the credential function such as [BearerToken].
+func NewFileCredentialProvider(path string, credential func(secret string) Credential) CredentialProvider {
+	f := &watchedFile{path: path}
+	return CredentialProviderFunc(func(_ *http.Request) (Credential, error) {
+		b, _, err := f.read()
+		if err != nil {
+			return nil, err
+		}
+		return credential(strings.TrimSpace(string(b))), nil
+	})
+}
+
+// NewNetrcCredentialProvider returns a [CredentialProvider] that sets the Basic credential
+// with the login and the password of the machine matching the request host in the netrc file.
+// If path is empty, '$NETRC' or '~/.netrc' is used.
+// The file is re-read when its modification time changes.
+func NewNetrcCredentialProvider(path string) CredentialProvider {
+	return &netrcCredentialProvider{file: &watchedFile{path: path}}
+}
+
+type netrcCredentialProvider struct {
+	file     *watchedFile
+	mu       sync.Mutex
+	machines []netrcMachine
+}
+
+type netrcMachine struct {
+	name     string
+	login    string
+	password string
+}
+
+func (p *netrcCredentialProvider) Credential(req *http.Request) (Credential, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.file.path == "" {
+		path, err := defaultNetrcPath()
+		if err != nil {
+			return nil, err
+		}
+		p.file.path = path
+	}
+	b, changed, err := p.file.read()
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		p.machines = parseNetrc(b)
+	}
+
+	host := req.URL.Hostname()
+	for _, m := range p.machines {
+		if m.name == host {
+			return BasicAuth(m.login, m.password), nil
+		}
+	}
+	for _, m := range p.machines {
+		if m.name == "" {
+			return BasicAuth(m.login, m.password), nil
+		}
+	}
+	return nil, nil
+}
+
+// defaultNetrcPath returns '$NETRC' or '~/.netrc'.
+func defaultNetrcPath() (string, error) {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".netrc"), nil
+}
+
+// parseNetrc parses the netrc file. 'default' is represented as the machine with empty name.
+func parseNetrc(b []byte) []netrcMachine {
+	var (
+		machines []netrcMachine
+		current  *netrcMachine
+		inMacro  bool
+	)
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		line := s.Text()
+		if inMacro {
+			// a macro definition ends with an empty line.
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		fields := strings.Fields(line)
+		for i := 0; i < len(fields); i++ {
+			switch fields[i] {
+			case "machine":
+				if i+1 < len(fields) {
+					machines = append(machines, netrcMachine{name: fields[i+1]})
+					current = &machines[len(machines)-1]
+					i++
+				}
+			case "default":
+				machines = append(machines, netrcMachine{})
+				current = &machines[len(machines)-1]
+			case "login", "password", "account":
+				if i+1 >= len(fields) {
+					continue
+				}
+				if current != nil {
+					switch fields[i] {
+					case "login":
+						current.login = fields[i+1]
+					case "password":
+						current.password = fields[i+1]
+					}
+				}
+				i++
+			case "macdef":
+				inMacro = true
+				i = len(fields)
+			}
+		}
+	}
+	return machines
+}
+
+// watchedFile is the file that is re-read when its modification time changes.
+type watchedFile struct {
+	path    string
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	content []byte
+}
+
+// read returns the content of the file and whether it has been changed since the last read.
+func (f *watchedFile) read() ([]byte, bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return nil, false, err
+	}
+	if f.content != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return f.content, false, nil
+	}
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return nil, false, err
+	}
+	f.content, f.modTime, f.size = b, info.ModTime(), info.Size()
+	return b, true, nil
+}
+
+// credentialTransport returns the function that sets the credential provided by the provider before sending the request.
+func credentialTransport(provider CredentialProvider, do func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		credential, err := provider.Credential(req)
+		if err != nil {
+			return nil, err
+		}
+		if credential != nil {
+			cloneHeader(req)
+			credential(req.Header)
+		}
+		return do(req)
+	}
+}
@@ -0,0 +1,122 @@
+package r2
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"iter"
+	"net/http"
+	"slices"
+)
+
+// Result is the response whose body is decoded into T.
+type Result[T any] struct {
+	// Value is the decoded response body.
+	// It is the zero value if the response status code is not 2xx or the response body could not be decoded.
+	Value T
+	// Response is the raw response. Its body can be read again.
+	Response *http.Response
+}
+
+// DecodeError is returned when the response body could not be decoded.
+type DecodeError struct {
+	// ContentType is the content type with which the response body was decoded.
+	ContentType string
+	// Err is the underlying error.
+	Err error
+}
+
+// Error implements error.
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("r2: failed to decode the response body as '%s': %v", e.ContentType, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// WithRetryOnDecodeError sets whether the request is retried when the response body could not be decoded.
+// By default, this setting is disabled and the iterator is terminated as the request succeeded.
+func WithRetryOnDecodeError(retryOnDecodeError bool) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetRetryOnDecodeError(retryOnDecodeError)
+	}
+}
+
+// GetJSON sends HTTP GET requests same as [Get], and yields [Result] whose 2xx response body is decoded into T as JSON.
+// If the response body could not be decoded, [DecodeError] is returned.
+func GetJSON[T any](ctx context.Context, url string, options ...internal.Option) iter.Seq2[Result[T], error] {
+	return doAs[T](ctx, url, http.MethodGet, nil, ContentTypeApplicationJSON, options...)
+}
+
+// GetXML sends HTTP GET requests same as [Get], and yields [Result] whose 2xx response body is decoded into T as XML.
+// If the response body could not be decoded, [DecodeError] is returned.
+func GetXML[T any](ctx context.Context, url string, options ...internal.Option) iter.Seq2[Result[T], error] {
+	return doAs[T](ctx, url, http.MethodGet, nil, ContentTypeApplicationXML, options...)
+}
+
+// DoAs sends HTTP requests same as [Do], and yields [Result] whose 2xx response body is decoded into T
+// with the codec registered for the response 'Content-Type'. See also [RegisterCodec].
+// If the response body could not be decoded, [DecodeError] is returned.
+func DoAs[T any](ctx context.Context, url, method string, body io.Reader, options ...internal.Option) iter.Seq2[Result[T], error] {
+	return doAs[T](ctx, url, method, body, "", options...)
+}
+
+// doAs sends HTTP requests and yields [Result] whose response body is decoded with the content type.
+// If contentType is empty, the response 'Content-Type' is used.
+func doAs[T any](ctx context.Context, url, method string, body io.Reader, contentType string, options ...internal.Option) iter.Seq2[Result[T], error] {
+	return func(yield func(Result[T], error) bool) {
+		var decoded T
+		hook := func(req *http.Request, res *http.Response) error {
+			if req.Method == http.MethodHead || res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices || res.StatusCode == http.StatusNoContent {
+				return nil
+			}
+			var v T
+			if err := decodeResponse(res, contentType, &v); err != nil {
+				return err
+			}
+			decoded = v
+			return nil
+		}
+		options = append(slices.Clip(options), func(p *internal.R2Prop) {
+			p.AddResponseHook(hook)
+		})
+		for res, err := range Do(ctx, url, method, body, options...) {
+			result := Result[T]{Value: decoded, Response: res}
+			decoded = *new(T)
+			if !yield(result, err) {
+				return
+			}
+		}
+	}
+}
+
+// decodeResponse decodes the response body into v.
+// The response body is replaced with the one that can be read again.
+func decodeResponse(res *http.Response, contentType string, v any) error {
+	if contentType == "" {
+		contentType = res.Header.Get("Content-Type")
+	}
+	var b []byte
+	if res.Body != nil && res.Body != http.NoBody {
+		var err error
+		b, err = io.ReadAll(res.Body)
+		res.Body.Close()
+		res.Body = io.NopCloser(bytes.NewReader(b))
+		if err != nil {
+			return &DecodeError{ContentType: contentType, Err: err}
+		}
+	}
+
+	codec, err := lookupCodec(contentType)
+	if err == nil {
+		err = codec.Unmarshal(b, v)
+	}
+	if err != nil {
+		return &DecodeError{ContentType: contentType, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,217 @@
+package r2
+
+import (
+	"context"
+	"errors"
+	"github.com/miyamo2/r2/internal"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrQueueFull is returned when the queue of [Dispatcher] is full.
+var ErrQueueFull = errors.New("r2: dispatcher queue is full")
+
+// ErrDispatcherClosed is returned when the request is submitted to [Dispatcher] after it is shut down.
+var ErrDispatcherClosed = errors.New("r2: dispatcher is closed")
+
+// Backpressure is the policy of [Dispatcher] when its queue is full.
+type Backpressure = internal.Backpressure
+
+const (
+	// BackpressureBlock blocks the submission until the queue has room.
+	BackpressureBlock = internal.BackpressureBlock
+	// BackpressureDrop drops the submitted request, and completes its future with [ErrQueueFull].
+	BackpressureDrop = internal.BackpressureDrop
+	// BackpressureError rejects the submission with [ErrQueueFull].
+	BackpressureError = internal.BackpressureError
+)
+
+// WithBackpressure sets the policy of [Dispatcher] when its queue is full.
+// Default: [BackpressureBlock]
+func WithBackpressure(backpressure Backpressure) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetBackpressure(backpressure)
+	}
+}
+
+// Dispatcher sends the submitted requests same as [Do] by the pool of the workers in the background.
+type Dispatcher struct {
+	prop    internal.R2Prop
+	options []internal.Option
+	hosts   *hostLimiter
+	queue   chan dispatchJob
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+
+	submitted atomic.Int64
+
+	// closing is closed when the shutdown begins, so that the blocked submissions give up.
+	closing   chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// dispatchJob is the request queued in Dispatcher.
+type dispatchJob struct {
+	ctx    context.Context
+	index  int
+	req    Request
+	future *Future
+}
+
+// Future is the outcome of the request submitted to [Dispatcher], which is completed in the future.
+type Future struct {
+	done    chan struct{}
+	outcome Outcome
+}
+
+// NewDispatcher returns a new [Dispatcher] with workers and the queue of queueSize, and starts the workers.
+// The options are applied to every request, and [WithPerHostConcurrency] limits the requests in flight per host.
+func NewDispatcher(workers, queueSize int, options ...internal.Option) *Dispatcher {
+	prop := internal.NewR2Prop(options...)
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		prop:    prop,
+		options: options,
+		hosts:   &hostLimiter{limit: prop.PerHostConcurrency(), slots: map[string]chan struct{}{}},
+		queue:   make(chan dispatchJob, max(queueSize, 0)),
+		ctx:     ctx,
+		cancel:  cancel,
+		closing: make(chan struct{}),
+	}
+	for range max(workers, 1) {
+		d.wg.Add(1)
+		go d.work()
+	}
+	return d
+}
+
+// Submit queues the request, and returns the [Future] of it immediately.
+//
+// The request is not canceled by ctx after it is queued, but the values of ctx are passed to the request.
+// When the queue is full, it follows the policy specified in [WithBackpressure].
+// If the dispatcher is shut down, including while the submission is blocked, [ErrDispatcherClosed] is returned.
+func (d *Dispatcher) Submit(ctx context.Context, req Request) (*Future, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return nil, ErrDispatcherClosed
+	}
+	future := &Future{done: make(chan struct{})}
+	job := dispatchJob{
+		ctx:    context.WithoutCancel(ctx),
+		index:  int(d.submitted.Add(1) - 1),
+		req:    req,
+		future: future,
+	}
+	switch d.prop.Backpressure() {
+	case BackpressureDrop:
+		select {
+		case d.queue <- job:
+		default:
+			future.complete(Outcome{Index: job.index, Request: req, Err: ErrQueueFull})
+		}
+	case BackpressureError:
+		select {
+		case d.queue <- job:
+		default:
+			return nil, ErrQueueFull
+		}
+	default:
+		select {
+		case d.queue <- job:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-d.closing:
+			return nil, ErrDispatcherClosed
+		}
+	}
+	return future, nil
+}
+
+// Shutdown stops accepting the requests, and waits for the queued requests to be completed.
+// If ctx is done before that, the remaining requests are canceled, and it returns the error of ctx
+// after every future is completed.
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	// the blocked submissions release the lock before the queue is closed.
+	d.closeOnce.Do(func() {
+		close(d.closing)
+	})
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// work sends the queued requests until the queue is closed.
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for job := range d.queue {
+		ctx, cancel := context.WithCancel(job.ctx)
+		stop := context.AfterFunc(d.ctx, cancel)
+		outcome := doRequest(ctx, job.index, job.req, d.hosts, d.options)
+		stop()
+		cancel()
+		if res := outcome.Response; res != nil {
+			// the body is buffered, so that the future can be left without closing it.
+			if _, err := bufferResponseBody(res); err != nil && outcome.Err == nil {
+				outcome.Err = err
+			}
+		}
+		job.future.complete(outcome)
+	}
+}
+
+// complete sets the outcome, and notifies the waiters.
+func (f *Future) complete(outcome Outcome) {
+	f.outcome = outcome
+	close(f.done)
+}
+
+// Done returns the channel that is closed when the request is completed.
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait waits for the request to be completed, and returns its last response and error.
+// The response body is buffered in memory, so that it does not need to be closed.
+// If ctx is done before that, the error of ctx is returned, but the request is not canceled.
+func (f *Future) Wait(ctx context.Context) (*http.Response, error) {
+	select {
+	case <-f.done:
+		return f.outcome.Response, f.outcome.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Outcome returns the outcome of the request, and true if it is completed.
+func (f *Future) Outcome() (Outcome, bool) {
+	select {
+	case <-f.done:
+		return f.outcome, true
+	default:
+		return Outcome{}, false
+	}
+}
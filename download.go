@@ -0,0 +1,211 @@
+package r2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ErrChecksumMismatch is returned when the downloaded file does not match the checksum specified in [WithChecksumSHA256].
+var ErrChecksumMismatch = errors.New("r2: downloaded file does not match the checksum")
+
+// headerKeyReprDigest is the header key for Repr-Digest
+const headerKeyReprDigest = "Repr-Digest"
+
+// WithChecksumSHA256 sets the expected SHA-256 checksum in hex of the file downloaded by [Download].
+// If the downloaded file does not match it, [ErrChecksumMismatch] is returned and the file is not created.
+func WithChecksumSHA256(checksum string) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetChecksumSHA256(checksum)
+	}
+}
+
+// WithFileMode sets the permissions of the file created by [Download].
+// Default: the permissions of the existing file, or 0600 if dst does not exist.
+func WithFileMode(mode os.FileMode) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetFileMode(mode)
+	}
+}
+
+// Download sends HTTP Get requests same as [Get], and writes the response body to the file dst.
+//
+// The body is written to the temporary file in the same directory as dst, and it is renamed to dst after the download is completed,
+// so that dst never has the incomplete content.
+// When the connection drops in the middle of the body, it resumes with 'Range: bytes=N-' guarded by 'If-Range'
+// with 'ETag' or 'Last-Modified' of the response.
+// If the server ignores 'Range' and responds with 200(OK), or the response has neither 'ETag' nor 'Last-Modified',
+// the download restarts from the beginning.
+//
+// Before the rename, the file is verified against the checksum specified in [WithChecksumSHA256],
+// and 'Repr-Digest' or 'Content-Digest' of the response if [WithVerifyContentDigest] is enabled.
+//
+// The download is given up when the request is interrupted by the termination condition other than success,
+// the resumption without progress exceeds the maximum number of requests specified in [WithMaxRequestAttempts],
+// or exceeds the deadline for the [context.Context] passed in the argument.
+func Download(ctx context.Context, url, dst string, options ...internal.Option) error {
+	prop := internal.NewR2Prop(options...)
+	options = append(slices.Clip(options), WithAutoCloseResponseBody(false), func(p *internal.R2Prop) {
+		// the file is verified instead of the response body.
+		p.SetVerifyContentDigest(false)
+	})
+
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.download")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		tmp.Close()
+		os.Remove(tmp.Name())
+	}()
+
+	var (
+		written   int64
+		validator string
+		digest    string
+	)
+	for resumes := 0; ; {
+		resumeFrom, ifRange := written, validator
+		newRequest := func(_ int) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			if resumeFrom > 0 && ifRange != "" {
+				req.Header.Set("Range", fmt.Sprintf("bytes=%d-", resumeFrom))
+				req.Header.Set("If-Range", ifRange)
+			}
+			return req, nil
+		}
+		res, err := connectStream(ctx, newRequest, options...)
+		if err != nil {
+			return err
+		}
+		if res.StatusCode == http.StatusPartialContent && contentRangeStart(res) != resumeFrom {
+			res.Body.Close()
+			if resumeFrom == 0 {
+				return fmt.Errorf("%w: %s, content-range: %s", ErrUnexpectedStatusCode, res.Status, res.Header.Get("Content-Range"))
+			}
+			// the unexpected part is sent, so that the download restarts from the beginning.
+			written, validator = 0, ""
+			continue
+		}
+		if res.StatusCode != http.StatusPartialContent || resumeFrom == 0 {
+			// the whole body is sent.
+			written, validator, digest = 0, resumeValidator(res), res.Header.Get(headerKeyContentDigest)
+			if err := tmp.Truncate(0); err != nil {
+				res.Body.Close()
+				return err
+			}
+		}
+		if reprDigest := res.Header.Get(headerKeyReprDigest); reprDigest != "" {
+			digest = reprDigest
+		}
+		if _, err := tmp.Seek(written, io.SeekStart); err != nil {
+			res.Body.Close()
+			return err
+		}
+		n, err := io.Copy(tmp, res.Body)
+		res.Body.Close()
+		written += n
+		if err == nil {
+			break
+		}
+
+		if n > 0 {
+			resumes = 0
+		}
+		resumes++
+		if ctx.Err() != nil || (prop.MaxRequestTimes() != 0 && resumes > prop.MaxRequestTimes()) {
+			return err
+		}
+		slog.Default().WarnContext(
+			ctx,
+			"[r2]: download dropped.",
+			slog.String("url", url),
+			slog.Int64("written", written),
+			slog.Any("error", err))
+		wait := prop.Interval()
+		if wait == 0 {
+			wait = backOff(resumes - 1)
+		}
+		select {
+		case <-ctx.Done():
+			slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
+			return ctx.Err()
+		case <-time.After(wait):
+			// no-op
+		}
+	}
+
+	if err := verifyDownload(tmp, prop.ChecksumSHA256(), digest, prop.VerifyContentDigest()); err != nil {
+		return err
+	}
+	mode := prop.FileMode().Perm()
+	if mode == 0 {
+		// the temporary file is created with 0600, so that the permissions of the existing file are kept.
+		if info, err := os.Stat(dst); err == nil {
+			mode = info.Mode().Perm()
+		}
+	}
+	if mode != 0 {
+		if err := tmp.Chmod(mode); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dst)
+}
+
+// resumeValidator returns the value of 'If-Range' header to resume the response.
+// Since the weak 'ETag' can not be used for 'If-Range', 'Last-Modified' is used instead.
+func resumeValidator(res *http.Response) string {
+	if etag := res.Header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return res.Header.Get("Last-Modified")
+}
+
+// verifyDownload verifies the downloaded file against the checksum and the digest header.
+func verifyDownload(f *os.File, checksum, digest string, verifyDigestHeader bool) error {
+	open := func() (io.Reader, error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return f, nil
+	}
+	if checksum != "" {
+		want, err := hex.DecodeString(checksum)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrChecksumMismatch, err)
+		}
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		if !slices.Equal(h.Sum(nil), want) {
+			return ErrChecksumMismatch
+		}
+	}
+	if verifyDigestHeader && digest != "" {
+		return verifyDigest(digest, open)
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package r2
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"iter"
+	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnexpectedEventStream is returned when the connection to the event stream is not established,
+// e.g. the response status code is not 2xx or 'Content-Type' is not 'text/event-stream'.
+var ErrUnexpectedEventStream = errors.New("r2: unexpected event stream")
+
+// Event is the event of Server-Sent Events.
+type Event struct {
+	// ID is the 'id' field, or the one of the previous event if not specified.
+	ID string
+	// Type is the 'event' field. 'message' if not specified.
+	Type string
+	// Data is the 'data' fields joined with LF.
+	Data string
+}
+
+// maxSeenEventIDs is the maximum number of the event IDs remembered to avoid yielding the same event again.
+const maxSeenEventIDs = 1024
+
+// requestHeaderKeyLastEventID is the header key for Last-Event-ID
+const requestHeaderKeyLastEventID = "Last-Event-ID"
+
+// Events connects to the Server-Sent Events stream, and yields the events.
+//
+// Each connection is sent same as [Get], so that the connection is retried until the [termination condition] is satisfied.
+// When the stream drops, it reconnects with 'Last-Event-ID' header after the interval specified in the 'retry' field,
+// [WithInterval] or the exponential backoff in this order.
+// The events whose 'id' field has already been yielded are not yielded again even if the server resends them.
+// Since the events without 'id' field can not be identified, they are yielded as is.
+//
+// The iteration is terminated when the connection is not established in the end, the response status code is 204(No Content),
+// exceeds the deadline for the [context.Context] passed in the argument, or the for range loop is interrupted by break.
+// If the connection is not established, [ErrUnexpectedEventStream] or the error of the last request is returned.
+//
+// [termination condition]: https://github.com/miyamo2/r2?tab=readme-ov-file#termination-conditions
+func Events(ctx context.Context, url string, options ...internal.Option) iter.Seq2[Event, error] {
+	prop := internal.NewR2Prop(options...)
+	return func(yield func(Event, error) bool) {
+		options := append(slices.Clip(options), WithAutoCloseResponseBody(false))
+		stream := &eventStream{seen: map[string]struct{}{}}
+		for reconnects := 0; ; reconnects++ {
+			if reconnects > 0 {
+				wait := stream.retry
+				if wait == 0 {
+					wait = prop.Interval()
+				}
+				if wait == 0 {
+					wait = backOff(reconnects - 1)
+				}
+				select {
+				case <-ctx.Done():
+					slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
+					return
+				case <-time.After(wait):
+					// no-op
+				}
+			}
+
+			res, err := connectEventStream(ctx, url, stream.lastEventID, options...)
+			if err != nil {
+				if ctx.Err() == nil {
+					yield(Event{}, err)
+				}
+				return
+			}
+			if res.StatusCode == http.StatusNoContent {
+				res.Body.Close()
+				return
+			}
+			received, err := stream.read(res.Body, yield)
+			res.Body.Close()
+			if err == nil || ctx.Err() != nil {
+				// the for range loop is interrupted by break, or the context is done.
+				return
+			}
+			if received {
+				reconnects = 0
+			}
+			slog.Default().WarnContext(
+				ctx,
+				"[r2]: event stream dropped.",
+				slog.String("url", url),
+				slog.String("last-event-id", stream.lastEventID),
+				slog.Any("error", err))
+		}
+	}
+}
+
+// connectEventStream connects to the event stream, and returns the response whose body is the stream.
+func connectEventStream(ctx context.Context, url, lastEventID string, options ...internal.Option) (*http.Response, error) {
+	newRequest := func(_ int) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", ContentTypeTextEventStream)
+		req.Header.Set("Cache-Control", "no-cache")
+		if lastEventID != "" {
+			req.Header.Set(requestHeaderKeyLastEventID, lastEventID)
+		}
+		return req, nil
+	}
+	var (
+		res     *http.Response
+		lastErr error
+	)
+	for r, err := range DoFunc(ctx, newRequest, options...) {
+		if res != nil && res.Body != nil {
+			res.Body.Close()
+		}
+		res, lastErr = r, err
+	}
+	if lastErr != nil {
+		if res != nil && res.Body != nil {
+			res.Body.Close()
+		}
+		return nil, lastErr
+	}
+	if res == nil {
+		return nil, ErrUnexpectedEventStream
+	}
+	if res.StatusCode == http.StatusNoContent {
+		return res, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices || mediaType != ContentTypeTextEventStream {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: status: %s, content-type: %s", ErrUnexpectedEventStream, res.Status, res.Header.Get("Content-Type"))
+	}
+	return res, nil
+}
+
+// eventStream is the state of the event stream that is kept across the connections.
+type eventStream struct {
+	lastEventID string
+	retry       time.Duration
+	seen        map[string]struct{}
+	seenOrder   []string
+}
+
+// read parses the event stream and yields the events until the stream drops.
+// It returns nil error only if yield returns false, and whether any event was received.
+func (s *eventStream) read(body io.Reader, yield func(Event, error) bool) (bool, error) {
+	var (
+		received  bool
+		data      strings.Builder
+		hasData   bool
+		hasID     bool
+		eventType string
+		eventID   = s.lastEventID
+	)
+	reader := bufio.NewReader(body)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// the incomplete event is discarded.
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return received, err
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			// dispatch the event.
+			s.lastEventID = eventID
+			if hasData {
+				received = true
+				event := Event{ID: eventID, Type: eventType, Data: data.String()}
+				if event.Type == "" {
+					event.Type = "message"
+				}
+				if (!hasID || event.ID == "" || s.markSeen(event.ID)) && !yield(event, nil) {
+					return received, nil
+				}
+			}
+			data.Reset()
+			hasData, hasID, eventType = false, false, ""
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// comment
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "data":
+			if hasData {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+			hasData = true
+		case "event":
+			eventType = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				eventID, hasID = value, true
+			}
+		case "retry":
+			if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+				s.retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+}
+
+// markSeen remembers the event ID, and returns false if it has already been seen.
+func (s *eventStream) markSeen(id string) bool {
+	if _, ok := s.seen[id]; ok {
+		return false
+	}
+	s.seen[id] = struct{}{}
+	s.seenOrder = append(s.seenOrder, id)
+	if len(s.seenOrder) > maxSeenEventIDs {
+		delete(s.seen, s.seenOrder[0])
+		s.seenOrder = s.seenOrder[1:]
+	}
+	return true
+}
@@ -1,13 +1,21 @@
 package r2_test
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/miyamo2/r2"
+	"github.com/miyamo2/r2/predicates"
 	"io"
 	"log/slog"
 	"net/http"
 	"net/url"
+	"os"
+	"sync"
 	"time"
 )
 
@@ -250,3 +258,617 @@ func ExampleWithAspect() {
 		_, _ = res, err
 	}
 }
+
+var myEd25519PrivateKey ed25519.PrivateKey
+
+func ExampleWithMessageSignature() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeApplicationJSON),
+		r2.WithMessageSignature(
+			r2.NewEd25519Signer("my-key-id", myEd25519PrivateKey),
+			r2.ComponentMethod, r2.ComponentTargetURI, r2.ComponentContentDigest, "content-type"),
+	}
+	body := bytes.NewBuffer([]byte(`{"foo": "bar"}`))
+	for res, err := range r2.Post(ctx, "https://example.com", body, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithContentDigest() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeApplicationJSON),
+		r2.WithContentDigest(r2.DigestAlgorithmSHA256),
+	}
+	body := bytes.NewBuffer([]byte(`{"foo": "bar"}`))
+	for res, err := range r2.Post(ctx, "https://example.com", body, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithVerifyContentDigest() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithVerifyContentDigest(true),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com", opts...) {
+		if errors.Is(err, r2.ErrContentDigestMismatch) {
+			// the request will be retried.
+			continue
+		}
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithCredentialProvider() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithCredentialProvider(r2.NewFileCredentialProvider("/var/run/secrets/my-token", r2.BearerToken)),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com", opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithKeyPool() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	pool := r2.NewKeyPool(r2.BearerToken, "api-key-1", "api-key-2", "api-key-3")
+	opts := []r2.Option{
+		r2.WithKeyPool(pool),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com", opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithBodySpooling() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeApplicationOctetStream),
+		// bodies larger than 32MiB are spooled to a temporary file instead of memory.
+		r2.WithBodySpooling(32 << 20),
+	}
+	var body io.Reader // e.g. a pipe, which can not be rewound by itself.
+	for res, err := range r2.Post(ctx, "https://example.com", body, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleDoFunc() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeApplicationJSON),
+		r2.WithMaxRequestAttempts(3),
+	}
+	newRequest := func(attempt int) (*http.Request, error) {
+		body := bytes.NewBuffer([]byte(fmt.Sprintf(`{"nonce": "%d-%d"}`, time.Now().UnixNano(), attempt)))
+		return http.NewRequest(http.MethodPost, "https://example.com", body)
+	}
+	for res, err := range r2.DoFunc(ctx, newRequest, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleGetJSON() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	type Item struct {
+		Name string `json:"name"`
+	}
+	for result, err := range r2.GetJSON[Item](ctx, "https://example.com") {
+		// result.Value is the decoded response body, and result.Response is the raw response.
+		_, _ = result, err
+	}
+}
+
+func ExampleGetXML() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	type Item struct {
+		Name string `xml:"name"`
+	}
+	for result, err := range r2.GetXML[Item](ctx, "https://example.com") {
+		// do something
+		_, _ = result, err
+	}
+}
+
+func ExampleDoAs() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	type Item struct {
+		Name string `json:"name" xml:"name"`
+	}
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeApplicationJSON),
+	}
+	body := bytes.NewBuffer([]byte(`{"name": "r2"}`))
+	for result, err := range r2.DoAs[Item](ctx, "https://example.com", http.MethodPost, body, opts...) {
+		// do something
+		_, _ = result, err
+	}
+}
+
+func ExampleWithRetryOnDecodeError() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	type Item struct {
+		Name string `json:"name"`
+	}
+	opts := []r2.Option{
+		r2.WithRetryOnDecodeError(true),
+	}
+	for result, err := range r2.GetJSON[Item](ctx, "https://example.com", opts...) {
+		var decodeErr *r2.DecodeError
+		if errors.As(err, &decodeErr) {
+			// the response body is broken, and the request is retried.
+		}
+		_ = result
+	}
+}
+
+func ExamplePostValue() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	type Item struct {
+		Name string `json:"name"`
+	}
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeApplicationJSON),
+	}
+	for res, err := range r2.PostValue(ctx, "https://example.com", Item{Name: "r2"}, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleRegisterCodec() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	var codec r2.Codec // e.g. a CBOR codec.
+	r2.RegisterCodec("application/cbor", codec)
+	opts := []r2.Option{
+		r2.WithContentType("application/cbor"),
+	}
+	for res, err := range r2.PostValue(ctx, "https://example.com", map[string]string{"name": "r2"}, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExamplePostMultipart() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	form := r2.NewMultipartForm().
+		AddField("name", "r2").
+		AddFile("file", "/path/to/file.txt").
+		AddReaderAt("data", "data.bin", bytes.NewReader([]byte("data")), 4)
+	for res, err := range r2.PostMultipart(ctx, "https://example.com", form) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithTerminateIf_predicates() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithTerminateIf(predicates.AllOf(
+			predicates.StatusIn(http.StatusOK),
+			predicates.JSONPathEquals("$.job.status", "done"),
+		)),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com", opts...) {
+		// the response body is still unread.
+		_, _ = res, err
+	}
+}
+
+func ExampleWithClassifier() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	errConflict := errors.New("conflict")
+	opts := []r2.Option{
+		r2.WithClassifier(func(res *http.Response, err error, attempt r2.Attempt) r2.Decision {
+			switch {
+			case res == nil:
+				return r2.Default()
+			case res.StatusCode == http.StatusServiceUnavailable:
+				return r2.RetryAfter(30 * time.Second)
+			case res.StatusCode == http.StatusConflict:
+				return r2.Fail(errConflict)
+			case res.Header.Get("X-Status") == "pending":
+				// this 200 is actually not completed.
+				return r2.Retry()
+			}
+			return r2.Default()
+		}),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com", opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithPeekLimit() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithTerminateIf(predicates.BodyContains(`"status":"done"`)),
+		// only the leading 1KiB of the body is read by the termination condition.
+		r2.WithPeekLimit(1 << 10),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com/large", opts...) {
+		// res.Body replays the leading 1KiB followed by the rest of the body.
+		_, _ = res, err
+	}
+}
+
+func ExampleWithHeaderOnlyInspection() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithTerminateIf(predicates.HeaderEquals("X-Job-State", "done")),
+		// the body is never read by the termination condition.
+		r2.WithHeaderOnlyInspection(true),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com/stream", opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleRetryAttempt() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	type Item struct {
+		Name string `json:"name"`
+	}
+	for res, err := range r2.Get(ctx, "https://example.com") {
+		if err != nil {
+			continue
+		}
+		var item Item
+		if err := json.NewDecoder(res.Body).Decode(&item); err != nil {
+			// the response is 200 but truncated, so the attempt is retried.
+			r2.RetryAttempt(res, err)
+			continue
+		}
+		// do something
+	}
+}
+
+func ExamplePollOperation() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+	body := bytes.NewBufferString(`{"name":"r2"}`)
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeApplicationJSON),
+	}
+	// POST returns 202 with 'Operation-Location', and the operation is polled until it is completed.
+	for res, err := range r2.PollOperation(ctx, "https://example.com/jobs", http.MethodPost, body, opts...) {
+		if errors.Is(err, r2.ErrOperationFailed) {
+			// the operation failed.
+		}
+		// the last response is the final resource.
+		_ = res
+	}
+}
+
+func ExampleWithPollInterval() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+	opts := []r2.Option{
+		// the operation is polled every 5 seconds unless 'Retry-After' is returned.
+		r2.WithPollInterval(5 * time.Second),
+	}
+	for res, err := range r2.PollOperation(ctx, "https://example.com/jobs", http.MethodPost, nil, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExampleWithStatusExtractor() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*10)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithStatusExtractor(func(res *http.Response) (r2.OperationStatus, error) {
+			switch res.Header.Get("X-Job-State") {
+			case "done":
+				return r2.OperationStatus{State: r2.OperationSucceeded, ResourceLocation: res.Header.Get("X-Result")}, nil
+			case "error":
+				return r2.OperationStatus{State: r2.OperationFailed}, nil
+			}
+			return r2.OperationStatus{State: r2.OperationRunning}, nil
+		}),
+	}
+	for res, err := range r2.PollOperation(ctx, "https://example.com/jobs", http.MethodPost, nil, opts...) {
+		// do something
+		_, _ = res, err
+	}
+}
+
+func ExamplePages() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	// follows 'Link: <https://example.com/items?page=2>; rel="next"'.
+	for res, err := range r2.Pages(ctx, "https://example.com/items", r2.LinkNextStrategy()) {
+		// do something with each page
+		_, _ = res, err
+	}
+	// sets '$.meta.next_cursor' of the response to the 'cursor' query parameter.
+	for res, err := range r2.Pages(ctx, "https://example.com/items", r2.CursorStrategy("$.meta.next_cursor", "cursor")) {
+		// do something with each page
+		_, _ = res, err
+	}
+	// increments the 'offset' query parameter by the number of '$.items' until the page is empty.
+	for res, err := range r2.Pages(ctx, "https://example.com/items", r2.OffsetStrategy("offset", "$.items")) {
+		// do something with each page
+		_, _ = res, err
+	}
+}
+
+func ExampleEvents() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for event, err := range r2.Events(ctx, "https://example.com/stream") {
+		if err != nil {
+			// the connection is not established.
+			break
+		}
+		fmt.Printf("id: %s, type: %s, data: %s\n", event.ID, event.Type, event.Data)
+	}
+}
+
+func ExampleGetNDJSON() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	type Record struct {
+		ID int `json:"id"`
+	}
+	// when the connection drops, the rest of the body is requested with 'Range: bytes=<offset>-'.
+	for record, err := range r2.GetNDJSON(ctx, "https://example.com/export.ndjson", r2.ResumeWithRange[Record]()) {
+		// do something
+		_, _ = record, err
+	}
+}
+
+func ExampleGetJSONArray() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	type Record struct {
+		ID int `json:"id"`
+	}
+	// the elements of the JSON array are decoded incrementally, and resumed with '?offset=<records>'.
+	for record, err := range r2.GetJSONArray(ctx, "https://example.com/export.json", r2.ResumeWithOffset[Record]("offset")) {
+		// do something
+		_, _ = record, err
+	}
+}
+
+func ExampleGetCSV() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	// the header is yielded only once, and resumed with '?after=<id of the last record>'.
+	resume := r2.ResumeWithCursor("after", func(last []string) string { return last[0] })
+	for record, err := range r2.GetCSV(ctx, "https://example.com/export.csv", true, resume) {
+		// do something
+		_, _ = record, err
+	}
+}
+
+func ExampleDownload() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	// the file is written to the temporary file, and renamed to '/path/to/file.zip' after completed.
+	if err := r2.Download(ctx, "https://example.com/file.zip", "/path/to/file.zip"); err != nil {
+		// the download is given up.
+		_ = err
+	}
+}
+
+func ExampleWithChecksumSHA256() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithChecksumSHA256("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"),
+	}
+	if err := r2.Download(ctx, "https://example.com/file.zip", "/path/to/file.zip", opts...); errors.Is(err, r2.ErrChecksumMismatch) {
+		// the downloaded file is broken.
+		_ = err
+	}
+}
+
+func ExampleDownloadChunks() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	f, err := os.Create("/path/to/artifact.tar.gz")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	opts := []r2.Option{
+		// the resource is split into 16 chunks, and at most 4 chunks are downloaded at the same time.
+		r2.WithChunks(16),
+		r2.WithConcurrency(4),
+		r2.WithProgress(func(done, total int64) {
+			fmt.Printf("%d/%d bytes\n", done, total)
+		}),
+	}
+	n, err := r2.DownloadChunks(ctx, "https://example.com/artifact.tar.gz", f, opts...)
+	// do something
+	_, _ = n, err
+}
+
+func ExampleOpenRemote() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	opts := []r2.Option{
+		// the reads are aligned to 64KiB blocks, and up to 16 blocks are cached.
+		r2.WithBlockCache(64<<10, 16),
+	}
+	f, err := r2.OpenRemote(ctx, "https://example.com/archive.zip", opts...)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	zr, err := zip.NewReader(f, f.Size())
+	var changedErr *r2.RemoteChangedError
+	if errors.As(err, &changedErr) {
+		// the archive is replaced while reading.
+		return
+	}
+	// do something
+	_ = zr
+}
+
+func ExampleUploadTus() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	f, err := os.Open("/path/to/video.mp4")
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return
+	}
+	opts := []r2.Option{
+		r2.WithTusChunkSize(16 << 20),
+		r2.WithTusMetadata(map[string]string{"filename": info.Name()}),
+		r2.WithTusChecksum(true),
+	}
+	location, err := r2.UploadTus(ctx, "https://example.com/files", f, info.Size(), opts...)
+	if errors.Is(err, r2.ErrUploadGone) {
+		// the upload is expired, and it must be created again.
+		return
+	}
+	// do something
+	_ = location
+}
+
+func ExampleWatch() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithLongPoll("wait", 30*time.Second),
+		r2.WithPeriod(time.Minute),
+	}
+	for res, err := range r2.Watch(ctx, "https://example.com/config.json", 5*time.Second, opts...) {
+		if err != nil {
+			// the poll failed, and the watch continues.
+			continue
+		}
+		var config map[string]any
+		if err := json.NewDecoder(res.Body).Decode(&config); err != nil {
+			continue
+		}
+		// do something
+	}
+}
+
+func ExampleWithCache() {
+	// the store may be shared with the other iterators.
+	store := r2.NewMemoryCacheStore(1000)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithCache(store),
+		r2.WithMaxRequestAttempts(3),
+	}
+	for res, err := range r2.Get(ctx, "https://example.com", opts...) {
+		if err != nil || res.StatusCode != http.StatusOK {
+			// the stale response is served at last when every attempt fails, if 'stale-if-error' allows.
+			continue
+		}
+		// do something
+	}
+}
+
+func ExampleWithCoalescing() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	opts := []r2.Option{
+		r2.WithCoalescing("Accept-Language"),
+		r2.WithMaxRequestAttempts(3),
+	}
+	var wg sync.WaitGroup
+	for range 200 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// the concurrent iterations share one sequence of the attempts.
+			for res, err := range r2.Get(ctx, "https://example.com", opts...) {
+				if err != nil || res.StatusCode != http.StatusOK {
+					continue
+				}
+				// each iteration receives its own copy of the response body.
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func ExampleDoAll() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	urls := []string{"https://example.com/1", "https://example.com/2", "https://example.org/1"}
+	requests := func(yield func(r2.Request) bool) {
+		for _, url := range urls {
+			if !yield(r2.Request{URL: url}) {
+				return
+			}
+		}
+	}
+	opts := []r2.Option{
+		r2.WithMaxRequestAttempts(3),
+		r2.WithPerHostConcurrency(4),
+	}
+	for outcome := range r2.DoAll(ctx, requests, 32, opts...) {
+		if outcome.Err != nil {
+			fmt.Printf("%s: %v\n", outcome.Request.URL, outcome.Err)
+			continue
+		}
+		// do something with outcome.Response
+	}
+}
+
+func ExampleDispatcher() {
+	ctx := context.Background()
+	opts := []r2.Option{
+		r2.WithMaxRequestAttempts(3),
+		r2.WithBackpressure(r2.BackpressureDrop),
+	}
+	d := r2.NewDispatcher(8, 100, opts...)
+	body := bytes.NewBufferString(`{"event":"login"}`)
+	future, err := d.Submit(ctx, r2.Request{Method: http.MethodPost, URL: "https://example.com/audit", Body: body})
+	if err != nil {
+		// handle error
+		return
+	}
+	// the queued requests are drained before shutdown.
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+	if err := d.Shutdown(shutdownCtx); err != nil {
+		// handle error
+	}
+	if outcome, ok := future.Outcome(); ok && outcome.Err != nil {
+		fmt.Printf("%s: %v\n", outcome.Request.URL, outcome.Err)
+	}
+}
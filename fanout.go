@@ -0,0 +1,203 @@
+package r2
+
+import (
+	"cmp"
+	"context"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+)
+
+// Request is the request sent by [DoAll] and [Dispatcher].
+type Request struct {
+	// Method is the HTTP method. If empty, GET is used.
+	Method string
+	// URL is the url of the request.
+	URL string
+	// Body is the request body.
+	Body io.Reader
+	// Options is the options for the request, applied after the options of [DoAll] or [NewDispatcher].
+	Options []internal.Option
+}
+
+// Outcome is the outcome of the request sent by [DoAll] and [Dispatcher].
+type Outcome struct {
+	// Index is the position of the request in the sequence passed to [DoAll], or the order of the submission to [Dispatcher].
+	Index int
+	// Request is the source request.
+	Request Request
+	// Response is the last response of the request, or nil.
+	Response *http.Response
+	// Err is the last error of the request.
+	Err error
+}
+
+// WithOrdered sets whether [DoAll] yields the outcomes in the order of the requests.
+// The completed outcomes wait for the preceding ones, and they occupy the slot of the concurrency meanwhile.
+// Default: false
+func WithOrdered(ordered bool) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetOrdered(ordered)
+	}
+}
+
+// WithPerHostConcurrency sets the maximum number of the requests of [DoAll] or [Dispatcher] in flight per host.
+// The request waiting for its host occupies the slot of the concurrency meanwhile.
+// Default: not limited
+func WithPerHostConcurrency(concurrency int) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetPerHostConcurrency(concurrency)
+	}
+}
+
+// DoAll sends the requests same as [Do] by the workers up to concurrency at a time,
+// and yields the last response and error of each request tagged with the source request as it completes.
+// If [WithOrdered] is enabled, the outcomes are yielded in the order of the requests.
+//
+// When the for range loop is interrupted by break, or exceeds the deadline for the [context.Context] passed in the argument,
+// the requests in flight are canceled and it returns after every worker stops.
+func DoAll(ctx context.Context, requests iter.Seq[Request], concurrency int, options ...internal.Option) iter.Seq[Outcome] {
+	prop := internal.NewR2Prop(options...)
+	return func(yield func(Outcome) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		autoClose, ordered := prop.AutoCloseResponseBody(), prop.Ordered()
+		var (
+			wg       sync.WaitGroup
+			slots    = make(chan struct{}, max(concurrency, 1))
+			outcomes = make(chan Outcome)
+			hosts    = &hostLimiter{limit: prop.PerHostConcurrency(), slots: map[string]chan struct{}{}}
+		)
+		go func() {
+			defer close(outcomes)
+			defer wg.Wait()
+			i := 0
+			for req := range requests {
+				select {
+				case slots <- struct{}{}:
+				case <-ctx.Done():
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				wg.Add(1)
+				go func(index int) {
+					defer wg.Done()
+					outcome := doRequest(ctx, index, req, hosts, options)
+					if !ordered {
+						<-slots
+					}
+					select {
+					case outcomes <- outcome:
+					case <-ctx.Done():
+						closeOutcome(outcome)
+					}
+				}(i)
+				i++
+			}
+		}()
+
+		emit := func(outcome Outcome) bool {
+			ok := yield(outcome)
+			if autoClose {
+				closeOutcome(outcome)
+			}
+			return ok
+		}
+		var (
+			pending = map[int]Outcome{}
+			next    int
+			stopped bool
+		)
+		for outcome := range outcomes {
+			if stopped {
+				closeOutcome(outcome)
+				continue
+			}
+			if !ordered {
+				if !emit(outcome) {
+					stopped = true
+					cancel()
+				}
+				continue
+			}
+			pending[outcome.Index] = outcome
+			for r, ok := pending[next]; ok && !stopped; r, ok = pending[next] {
+				delete(pending, next)
+				next++
+				<-slots
+				if !emit(r) {
+					stopped = true
+					cancel()
+				}
+			}
+		}
+		for _, outcome := range pending {
+			closeOutcome(outcome)
+		}
+	}
+}
+
+// doRequest sends the request same as [Do], and returns the last response and error.
+func doRequest(ctx context.Context, index int, req Request, hosts *hostLimiter, options []internal.Option) Outcome {
+	outcome := Outcome{Index: index, Request: req}
+	release, err := hosts.acquire(ctx, req.URL)
+	if err != nil {
+		outcome.Err = err
+		return outcome
+	}
+	defer release()
+
+	options = append(append(slices.Clip(options), req.Options...), WithAutoCloseResponseBody(false))
+	for res, err := range Do(ctx, req.URL, cmp.Or(req.Method, http.MethodGet), req.Body, options...) {
+		closeOutcome(outcome)
+		outcome.Response, outcome.Err = res, err
+	}
+	if outcome.Response == nil && outcome.Err == nil {
+		outcome.Err = cmp.Or(ctx.Err(), ErrUnexpectedStatusCode)
+	}
+	return outcome
+}
+
+// closeOutcome closes the response body of the outcome.
+func closeOutcome(outcome Outcome) {
+	if outcome.Response != nil && outcome.Response.Body != nil {
+		outcome.Response.Body.Close()
+	}
+}
+
+// hostLimiter limits the number of the requests in flight per host.
+type hostLimiter struct {
+	limit int
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// acquire waits for the slot of the host of rawURL, and returns the function that releases it.
+func (l *hostLimiter) acquire(ctx context.Context, rawURL string) (func(), error) {
+	if l.limit <= 0 {
+		return noop, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		// the request fails anyway.
+		return noop, nil
+	}
+	l.mu.Lock()
+	slot, ok := l.slots[u.Host]
+	if !ok {
+		slot = make(chan struct{}, l.limit)
+		l.slots[u.Host] = slot
+	}
+	l.mu.Unlock()
+	select {
+	case slot <- struct{}{}:
+		return func() { <-slot }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
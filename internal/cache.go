@@ -0,0 +1,33 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+)
+
+// CacheEntry is the response stored in the HTTP cache.
+type CacheEntry struct {
+	// StatusCode is the status code of the response.
+	StatusCode int
+	// Header is the header of the response.
+	Header http.Header
+	// Body is the body of the response.
+	Body []byte
+	// RequestTime is the time when the request is sent.
+	RequestTime time.Time
+	// ResponseTime is the time when the response is received.
+	ResponseTime time.Time
+	// VaryHeader is the request header nominated by 'Vary' header of the response.
+	VaryHeader http.Header
+}
+
+// CacheStore is an abstraction of the storage of the HTTP cache.
+// It may be shared with the other iterators, so it must be safe for concurrent use.
+type CacheStore interface {
+	// Get returns the entry of key. If it is not found, it returns nil and false.
+	Get(key string) (*CacheEntry, bool)
+	// Set stores the entry of key.
+	Set(key string, entry *CacheEntry)
+	// Delete removes the entry of key.
+	Delete(key string)
+}
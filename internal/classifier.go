@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"net/http"
+	"time"
+)
+
+// Action specifies what the iterator does after the response is yielded.
+type Action int
+
+const (
+	// ActionDefault follows the built-in rules.
+	ActionDefault Action = iota
+	// ActionStop terminates the iterator.
+	ActionStop
+	// ActionRetry sends the next request after the built-in interval.
+	ActionRetry
+	// ActionRetryAfter sends the next request after the wait.
+	ActionRetryAfter
+	// ActionFail terminates the iterator with the error.
+	ActionFail
+)
+
+// Decision is the result of the [Classifier].
+type Decision struct {
+	Action Action
+	Wait   time.Duration
+	Err    error
+}
+
+// Attempt is the information of the attempt that is classified.
+type Attempt struct {
+	// Number is the number of the attempt starting from 0.
+	Number int
+	// Request is the request sent in the attempt.
+	Request *http.Request
+}
+
+// Classifier classifies the response and error of the attempt into the [Decision].
+type Classifier func(res *http.Response, err error, attempt Attempt) Decision
@@ -0,0 +1,13 @@
+package internal
+
+import (
+	"net/http"
+)
+
+// Credential sets the credential to the request header.
+type Credential func(header http.Header)
+
+// CredentialProvider is an abstraction of the provider of the credential that is consulted before every request.
+type CredentialProvider interface {
+	Credential(req *http.Request) (Credential, error)
+}
@@ -0,0 +1,13 @@
+package internal
+
+// Backpressure is the policy of the dispatcher when its queue is full.
+type Backpressure int
+
+const (
+	// BackpressureBlock blocks the submission until the queue has room.
+	BackpressureBlock Backpressure = iota
+	// BackpressureDrop drops the submitted request, and completes its future with the error.
+	BackpressureDrop
+	// BackpressureError rejects the submission with the error.
+	BackpressureError
+)
@@ -9,6 +9,12 @@ import (
 // ResponseHeaderKeyRetryAfter is the header key for Retry-After
 const ResponseHeaderKeyRetryAfter = "Retry-After"
 
+// ResponseHeaderKeyOperationLocation is the header key for Operation-Location
+const ResponseHeaderKeyOperationLocation = "Operation-Location"
+
+// ResponseHeaderKeyLocation is the header key for Location
+const ResponseHeaderKeyLocation = "Location"
+
 // HttpClient is an abstraction of the http.Client
 type HttpClient interface {
 	Do(req *http.Request) (*http.Response, error)
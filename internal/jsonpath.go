@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LookupJSONPath returns the raw JSON value at the path.
+// The path is the dot-separated keys and indexes such as '$.items[0].status' or 'items.0.status'.
+func LookupJSONPath(b []byte, path string) (json.RawMessage, error) {
+	raw := json.RawMessage(b)
+	for _, segment := range splitJSONPath(path) {
+		if index, err := strconv.Atoi(segment); err == nil {
+			var array []json.RawMessage
+			if err := json.Unmarshal(raw, &array); err == nil {
+				if index < 0 || index >= len(array) {
+					return nil, fmt.Errorf("index %d out of range", index)
+				}
+				raw = array[index]
+				continue
+			}
+		}
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &object); err != nil {
+			return nil, err
+		}
+		v, ok := object[segment]
+		if !ok {
+			return nil, fmt.Errorf("key '%s' is not found", segment)
+		}
+		raw = v
+	}
+	return raw, nil
+}
+
+// splitJSONPath splits the path such as '$.items[0].status' into the segments 'items', '0' and 'status'.
+func splitJSONPath(path string) []string {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return nil
+	}
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	return strings.Split(path, ".")
+}
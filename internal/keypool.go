@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"sync"
+	"time"
+)
+
+// KeyPool is the pool of the keys that are rotated when the key is rate-limited.
+type KeyPool struct {
+	mu         sync.Mutex
+	keys       []*pooledKey
+	credential func(key string) Credential
+}
+
+type pooledKey struct {
+	value         string
+	limitedAt     time.Time
+	cooldownUntil time.Time
+}
+
+// NewKeyPool returns a new KeyPool.
+func NewKeyPool(credential func(key string) Credential, keys ...string) *KeyPool {
+	p := &KeyPool{
+		keys:       make([]*pooledKey, 0, len(keys)),
+		credential: credential,
+	}
+	for _, k := range keys {
+		p.keys = append(p.keys, &pooledKey{value: k})
+	}
+	return p
+}
+
+// Acquire returns the least-recently-limited key that is not cooling down, and its credential.
+// If every key is cooling down, it returns the key that cools down first, and the duration until then.
+func (p *KeyPool) Acquire() (key string, credential Credential, wait time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.keys) == 0 {
+		return "", nil, 0
+	}
+
+	now := time.Now()
+	var available, earliest *pooledKey
+	for _, k := range p.keys {
+		if !k.cooldownUntil.After(now) {
+			if available == nil || k.limitedAt.Before(available.limitedAt) {
+				available = k
+			}
+			continue
+		}
+		if earliest == nil || k.cooldownUntil.Before(earliest.cooldownUntil) {
+			earliest = k
+		}
+	}
+	if available != nil {
+		return available.value, p.credential(available.value), 0
+	}
+	return earliest.value, p.credential(earliest.value), earliest.cooldownUntil.Sub(now)
+}
+
+// Limit marks the key as rate-limited. The key goes back into the pool after the cooldown.
+func (p *KeyPool) Limit(key string, cooldown time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, k := range p.keys {
+		if k.value == key {
+			k.limitedAt = now
+			k.cooldownUntil = now.Add(cooldown)
+			return
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package internal
+
+import "net/http"
+
+// OperationState is the state of the long-running operation.
+type OperationState int
+
+const (
+	// OperationRunning is the state that the operation is not completed yet.
+	OperationRunning OperationState = iota
+	// OperationSucceeded is the state that the operation is completed successfully.
+	OperationSucceeded
+	// OperationFailed is the state that the operation is completed unsuccessfully, including canceled.
+	OperationFailed
+)
+
+// OperationStatus is the status of the long-running operation extracted from the polling response.
+type OperationStatus struct {
+	State            OperationState
+	ResourceLocation string
+}
+
+// StatusExtractor extracts the status of the long-running operation from the polling response.
+type StatusExtractor func(res *http.Response) (OperationStatus, error)
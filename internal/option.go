@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"io/fs"
 	"net/http"
 	"time"
 )
@@ -8,6 +9,12 @@ import (
 // Option specifies optional parameters to r2.
 type Option func(*R2Prop)
 
+// ResponseHook inspects the response before it is yielded.
+type ResponseHook func(req *http.Request, res *http.Response) error
+
+// ProgressFunc reports the number of bytes done and the total.
+type ProgressFunc func(done, total int64)
+
 // Aspect adding behavior to the pre-request/post-request.
 type Aspect func(req *http.Request, do func(req *http.Request) (*http.Response, error)) (*http.Response, error)
 
@@ -22,10 +29,41 @@ type R2Prop struct {
 	maxRequestTimes       int
 	interval              time.Duration
 	period                time.Duration
-	terminationCondition  TerminationCondition
+	classifier            Classifier
 	newRequest            NewRequest
 	aspect                Aspect
 	autoCloseResponseBody bool
+	contentDigest         string
+	messageSignature      *MessageSignature
+	verifyContentDigest   bool
+	credentialProvider    CredentialProvider
+	keyPool               *KeyPool
+	spoolThreshold        int64
+	responseHooks         []ResponseHook
+	retryOnDecodeError    bool
+	peekLimit             int64
+	headerOnlyInspection  bool
+	pollInterval          time.Duration
+	statusExtractor       StatusExtractor
+	checksumSHA256        string
+	fileMode              fs.FileMode
+	chunks                int
+	concurrency           int
+	progress              ProgressFunc
+	blockSize             int64
+	cacheBlocks           int
+	tusChunkSize          int64
+	tusMetadata           map[string]string
+	tusChecksum           bool
+	tusUploadURL          string
+	longPollParam         string
+	longPollWait          time.Duration
+	cacheStore            CacheStore
+	coalescing            bool
+	coalescingHeaders     []string
+	ordered               bool
+	perHostConcurrency    int
+	backpressure          Backpressure
 }
 
 // SetClient sets the client.
@@ -57,9 +95,9 @@ func (p *R2Prop) SetPeriod(period time.Duration) {
 	p.period = period
 }
 
-// SetTerminationCondition sets the termination condition.
-func (p *R2Prop) SetTerminationCondition(terminationCondition TerminationCondition) {
-	p.terminationCondition = terminationCondition
+// SetClassifier sets the classifier.
+func (p *R2Prop) SetClassifier(classifier Classifier) {
+	p.classifier = classifier
 }
 
 // SetNewRequestFunc sets the new request function.
@@ -77,6 +115,149 @@ func (p *R2Prop) SetAutoCloseResponseBody(autoCloseResponse bool) {
 	p.autoCloseResponseBody = autoCloseResponse
 }
 
+// SetContentDigest sets the algorithm of the request 'Content-Digest'.
+func (p *R2Prop) SetContentDigest(algorithm string) {
+	p.contentDigest = algorithm
+}
+
+// SetMessageSignature sets the message signature.
+func (p *R2Prop) SetMessageSignature(messageSignature *MessageSignature) {
+	p.messageSignature = messageSignature
+}
+
+// SetVerifyContentDigest sets whether the response 'Content-Digest' is verified.
+func (p *R2Prop) SetVerifyContentDigest(verifyContentDigest bool) {
+	p.verifyContentDigest = verifyContentDigest
+}
+
+// SetCredentialProvider sets the credential provider.
+func (p *R2Prop) SetCredentialProvider(credentialProvider CredentialProvider) {
+	p.credentialProvider = credentialProvider
+}
+
+// SetKeyPool sets the key pool.
+func (p *R2Prop) SetKeyPool(keyPool *KeyPool) {
+	p.keyPool = keyPool
+}
+
+// SetSpoolThreshold sets the threshold above which the request body is spooled to a temporary file.
+func (p *R2Prop) SetSpoolThreshold(spoolThreshold int64) {
+	p.spoolThreshold = spoolThreshold
+}
+
+// AddResponseHook adds the response hook.
+func (p *R2Prop) AddResponseHook(hook ResponseHook) {
+	p.responseHooks = append(p.responseHooks, hook)
+}
+
+// SetRetryOnDecodeError sets whether the request is retried when the response body could not be decoded.
+func (p *R2Prop) SetRetryOnDecodeError(retryOnDecodeError bool) {
+	p.retryOnDecodeError = retryOnDecodeError
+}
+
+// SetPeekLimit sets the maximum number of bytes of the response body inspected by the classifier.
+func (p *R2Prop) SetPeekLimit(peekLimit int64) {
+	p.peekLimit = peekLimit
+}
+
+// SetHeaderOnlyInspection sets whether the classifier inspects only the response header.
+func (p *R2Prop) SetHeaderOnlyInspection(headerOnlyInspection bool) {
+	p.headerOnlyInspection = headerOnlyInspection
+}
+
+// SetPollInterval sets the interval between the polls of the long-running operation.
+func (p *R2Prop) SetPollInterval(pollInterval time.Duration) {
+	p.pollInterval = pollInterval
+}
+
+// SetStatusExtractor sets the extractor of the status of the long-running operation.
+func (p *R2Prop) SetStatusExtractor(statusExtractor StatusExtractor) {
+	p.statusExtractor = statusExtractor
+}
+
+// SetChecksumSHA256 sets the expected SHA-256 checksum of the downloaded file in hex.
+func (p *R2Prop) SetChecksumSHA256(checksumSHA256 string) {
+	p.checksumSHA256 = checksumSHA256
+}
+
+// SetFileMode sets the permissions of the downloaded file.
+func (p *R2Prop) SetFileMode(fileMode fs.FileMode) {
+	p.fileMode = fileMode
+}
+
+// SetChunks sets the number of the chunks that the download is split into.
+func (p *R2Prop) SetChunks(chunks int) {
+	p.chunks = chunks
+}
+
+// SetConcurrency sets the maximum number of the chunks that are downloaded concurrently.
+func (p *R2Prop) SetConcurrency(concurrency int) {
+	p.concurrency = concurrency
+}
+
+// SetProgress sets the function that reports the progress of the download.
+func (p *R2Prop) SetProgress(progress ProgressFunc) {
+	p.progress = progress
+}
+
+// SetBlockCache sets the size of the block and the maximum number of the blocks cached by the remote file.
+func (p *R2Prop) SetBlockCache(blockSize int64, cacheBlocks int) {
+	p.blockSize = blockSize
+	p.cacheBlocks = cacheBlocks
+}
+
+// SetTusChunkSize sets the size of the chunk sent by each PATCH request of the tus upload.
+func (p *R2Prop) SetTusChunkSize(size int64) {
+	p.tusChunkSize = size
+}
+
+// SetTusMetadata sets the metadata of the tus upload.
+func (p *R2Prop) SetTusMetadata(metadata map[string]string) {
+	p.tusMetadata = metadata
+}
+
+// SetTusChecksum sets whether the chunks of the tus upload are sent with 'Upload-Checksum'.
+func (p *R2Prop) SetTusChecksum(checksum bool) {
+	p.tusChecksum = checksum
+}
+
+// SetTusUploadURL sets the url of the tus upload to resume.
+func (p *R2Prop) SetTusUploadURL(url string) {
+	p.tusUploadURL = url
+}
+
+// SetLongPoll sets the query parameter and the duration that the server holds the watch request.
+func (p *R2Prop) SetLongPoll(param string, wait time.Duration) {
+	p.longPollParam = param
+	p.longPollWait = wait
+}
+
+// SetCacheStore sets the storage of the HTTP cache.
+func (p *R2Prop) SetCacheStore(store CacheStore) {
+	p.cacheStore = store
+}
+
+// SetCoalescing sets whether the identical requests in flight are coalesced, and the headers that distinguish them.
+func (p *R2Prop) SetCoalescing(coalescing bool, headers []string) {
+	p.coalescing = coalescing
+	p.coalescingHeaders = headers
+}
+
+// SetOrdered sets whether the results of the fan-out are yielded in the order of the requests.
+func (p *R2Prop) SetOrdered(ordered bool) {
+	p.ordered = ordered
+}
+
+// SetPerHostConcurrency sets the maximum number of the requests of the fan-out in flight per host.
+func (p *R2Prop) SetPerHostConcurrency(concurrency int) {
+	p.perHostConcurrency = concurrency
+}
+
+// SetBackpressure sets the policy of the dispatcher when its queue is full.
+func (p *R2Prop) SetBackpressure(backpressure Backpressure) {
+	p.backpressure = backpressure
+}
+
 // Client returns the client. If the client is nil, it returns http.DefaultClient.
 func (p *R2Prop) Client() HttpClient {
 	return p.client
@@ -124,9 +305,9 @@ func (p *R2Prop) ContentType() string {
 	return p.contentType
 }
 
-// TerminationCondition returns the termination condition.
-func (p *R2Prop) TerminationCondition() TerminationCondition {
-	return p.terminationCondition
+// Classifier returns the classifier.
+func (p *R2Prop) Classifier() Classifier {
+	return p.classifier
 }
 
 // Aspect returns the behavior to the pre-request/post-request.
@@ -139,6 +320,174 @@ func (p *R2Prop) AutoCloseResponseBody() bool {
 	return p.autoCloseResponseBody
 }
 
+// ContentDigest returns the algorithm of the request 'Content-Digest'.
+func (p *R2Prop) ContentDigest() string {
+	return p.contentDigest
+}
+
+// MessageSignature returns the message signature.
+func (p *R2Prop) MessageSignature() *MessageSignature {
+	return p.messageSignature
+}
+
+// VerifyContentDigest returns whether the response 'Content-Digest' is verified.
+func (p *R2Prop) VerifyContentDigest() bool {
+	return p.verifyContentDigest
+}
+
+// CredentialProvider returns the credential provider.
+func (p *R2Prop) CredentialProvider() CredentialProvider {
+	return p.credentialProvider
+}
+
+// KeyPool returns the key pool.
+func (p *R2Prop) KeyPool() *KeyPool {
+	return p.keyPool
+}
+
+// SpoolThreshold returns the threshold above which the request body is spooled to a temporary file.
+// If the threshold is less than 0, it returns 0.
+func (p *R2Prop) SpoolThreshold() int64 {
+	if p.spoolThreshold < 0 {
+		return 0
+	}
+	return p.spoolThreshold
+}
+
+// ResponseHooks returns the response hooks.
+func (p *R2Prop) ResponseHooks() []ResponseHook {
+	return p.responseHooks
+}
+
+// RetryOnDecodeError returns whether the request is retried when the response body could not be decoded.
+func (p *R2Prop) RetryOnDecodeError() bool {
+	return p.retryOnDecodeError
+}
+
+// PeekLimit returns the maximum number of bytes of the response body inspected by the classifier.
+// If less than or equal to 0, the whole response body is inspected.
+func (p *R2Prop) PeekLimit() int64 {
+	if p.peekLimit < 0 {
+		return 0
+	}
+	return p.peekLimit
+}
+
+// HeaderOnlyInspection returns whether the classifier inspects only the response header.
+func (p *R2Prop) HeaderOnlyInspection() bool {
+	return p.headerOnlyInspection
+}
+
+// PollInterval returns the interval between the polls of the long-running operation.
+// If the interval is less than 0, it returns 0.
+func (p *R2Prop) PollInterval() time.Duration {
+	if p.pollInterval < 0 {
+		return 0
+	}
+	return p.pollInterval
+}
+
+// StatusExtractor returns the extractor of the status of the long-running operation.
+func (p *R2Prop) StatusExtractor() StatusExtractor {
+	return p.statusExtractor
+}
+
+// ChecksumSHA256 returns the expected SHA-256 checksum of the downloaded file in hex.
+func (p *R2Prop) ChecksumSHA256() string {
+	return p.checksumSHA256
+}
+
+// FileMode returns the permissions of the downloaded file.
+func (p *R2Prop) FileMode() fs.FileMode {
+	return p.fileMode
+}
+
+// Chunks returns the number of the chunks that the download is split into. If less than or equal to 0, it returns 4.
+func (p *R2Prop) Chunks() int {
+	if p.chunks <= 0 {
+		return 4
+	}
+	return p.chunks
+}
+
+// Concurrency returns the maximum number of the chunks that are downloaded concurrently.
+// If less than or equal to 0, it returns the number of the chunks.
+func (p *R2Prop) Concurrency() int {
+	if p.concurrency <= 0 {
+		return p.Chunks()
+	}
+	return p.concurrency
+}
+
+// Progress returns the function that reports the progress of the download.
+func (p *R2Prop) Progress() ProgressFunc {
+	return p.progress
+}
+
+// BlockCache returns the size of the block and the maximum number of the blocks cached by the remote file.
+// If either of them is less than or equal to 0, the cache is disabled and it returns 0 and 0.
+func (p *R2Prop) BlockCache() (int64, int) {
+	if p.blockSize <= 0 || p.cacheBlocks <= 0 {
+		return 0, 0
+	}
+	return p.blockSize, p.cacheBlocks
+}
+
+// TusChunkSize returns the size of the chunk sent by each PATCH request of the tus upload.
+// If less than or equal to 0, it returns 4MiB.
+func (p *R2Prop) TusChunkSize() int64 {
+	if p.tusChunkSize <= 0 {
+		return 4 << 20
+	}
+	return p.tusChunkSize
+}
+
+// TusMetadata returns the metadata of the tus upload.
+func (p *R2Prop) TusMetadata() map[string]string {
+	return p.tusMetadata
+}
+
+// TusChecksum returns whether the chunks of the tus upload are sent with 'Upload-Checksum'.
+func (p *R2Prop) TusChecksum() bool {
+	return p.tusChecksum
+}
+
+// TusUploadURL returns the url of the tus upload to resume.
+func (p *R2Prop) TusUploadURL() string {
+	return p.tusUploadURL
+}
+
+// LongPoll returns the query parameter and the duration that the server holds the watch request.
+func (p *R2Prop) LongPoll() (string, time.Duration) {
+	return p.longPollParam, p.longPollWait
+}
+
+// CacheStore returns the storage of the HTTP cache.
+func (p *R2Prop) CacheStore() CacheStore {
+	return p.cacheStore
+}
+
+// Coalescing returns whether the identical requests in flight are coalesced, and the headers that distinguish them.
+func (p *R2Prop) Coalescing() (bool, []string) {
+	return p.coalescing, p.coalescingHeaders
+}
+
+// Ordered returns whether the results of the fan-out are yielded in the order of the requests.
+func (p *R2Prop) Ordered() bool {
+	return p.ordered
+}
+
+// PerHostConcurrency returns the maximum number of the requests of the fan-out in flight per host.
+// If less than or equal to 0, it is not limited and it returns 0.
+func (p *R2Prop) PerHostConcurrency() int {
+	return max(p.perHostConcurrency, 0)
+}
+
+// Backpressure returns the policy of the dispatcher when its queue is full.
+func (p *R2Prop) Backpressure() Backpressure {
+	return p.backpressure
+}
+
 // NewR2Prop returns a new R2Prop.
 func NewR2Prop(opts ...Option) R2Prop {
 	p := R2Prop{
@@ -147,6 +496,7 @@ func NewR2Prop(opts ...Option) R2Prop {
 			return do(req)
 		},
 		autoCloseResponseBody: true,
+		pollInterval:          time.Second,
 	}
 	for _, o := range opts {
 		o(&p)
@@ -0,0 +1,18 @@
+package internal
+
+// Signer is an abstraction of the key that signs HTTP message signatures.
+type Signer interface {
+	// KeyID returns the value of the 'keyid' signature parameter.
+	KeyID() string
+	// Algorithm returns the value of the 'alg' signature parameter.
+	Algorithm() string
+	// Sign returns the signature of the signature base.
+	Sign(signatureBase []byte) ([]byte, error)
+}
+
+// MessageSignature is the configuration of the HTTP message signatures.
+type MessageSignature struct {
+	Label      string
+	Signer     Signer
+	Components []string
+}
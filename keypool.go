@@ -0,0 +1,49 @@
+package r2
+
+import (
+	"context"
+	"github.com/miyamo2/r2/internal"
+	"net/http"
+	"time"
+)
+
+// KeyPool is the pool of the keys such as API keys, that are rotated when the key is rate-limited.
+type KeyPool = internal.KeyPool
+
+// NewKeyPool returns a [KeyPool]. The key is converted to the [Credential] by the credential function such as [BearerToken].
+func NewKeyPool(credential func(key string) Credential, keys ...string) *KeyPool {
+	return internal.NewKeyPool(credential, keys...)
+}
+
+// WithKeyPool sets the pool of the keys that are rotated when the response status code is 429(Too Many Request).
+//
+// The rate-limited key is cooling down for the duration conforming to 'Retry-After' header,
+// and the next request is sent immediately with the least-recently-limited key instead of waiting.
+// The iterator waits only when every key is cooling down.
+//
+// The pool may be shared with the other iterators.
+func WithKeyPool(keyPool *KeyPool) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetKeyPool(keyPool)
+	}
+}
+
+// useKeyFromPool sets the key acquired from the pool to the request, and returns the key.
+//
+// If every key is cooling down, it waits until the first one cools down.
+func useKeyFromPool(ctx context.Context, pool *KeyPool, req *http.Request) (string, error) {
+	key, credential, wait := pool.Acquire()
+	if wait > 0 {
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(wait):
+			// no-op
+		}
+	}
+	if credential != nil {
+		cloneHeader(req)
+		credential(req.Header)
+	}
+	return key, nil
+}
@@ -0,0 +1,254 @@
+package r2
+
+import (
+	"context"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"io/fs"
+	"iter"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// MultipartForm is the builder of the multipart/form-data request body.
+//
+// The body is not held in memory. It is streamed from the sources of the parts on every attempt,
+// so the files must not be modified until the iterator finishes.
+type MultipartForm struct {
+	boundary string
+	parts    []multipartPart
+}
+
+// multipartPart is the part of [MultipartForm].
+type multipartPart struct {
+	header textproto.MIMEHeader
+	// open returns the content of the part.
+	open func() (io.ReadCloser, error)
+	// size returns the size of the content.
+	size func() (int64, error)
+}
+
+// NewMultipartForm returns a new [MultipartForm] with a random boundary.
+// The boundary is fixed for all attempts.
+func NewMultipartForm() *MultipartForm {
+	return &MultipartForm{boundary: multipart.NewWriter(io.Discard).Boundary()}
+}
+
+// AddField adds the form field.
+func (f *MultipartForm) AddField(name, value string) *MultipartForm {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"`, escapeQuotes(name)))
+	f.parts = append(f.parts, multipartPart{
+		header: header,
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(value)), nil
+		},
+		size: func() (int64, error) {
+			return int64(len(value)), nil
+		},
+	})
+	return f
+}
+
+// AddFile adds the file part whose content is read from the file at path on every attempt.
+func (f *MultipartForm) AddFile(fieldName, path string) *MultipartForm {
+	f.parts = append(f.parts, multipartPart{
+		header: fileHeader(fieldName, filepath.Base(path)),
+		open: func() (io.ReadCloser, error) {
+			return os.Open(path)
+		},
+		size: func() (int64, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return 0, err
+			}
+			return info.Size(), nil
+		},
+	})
+	return f
+}
+
+// AddFileFS adds the file part whose content is read from the file named name in fsys on every attempt.
+func (f *MultipartForm) AddFileFS(fieldName string, fsys fs.FS, name string) *MultipartForm {
+	f.parts = append(f.parts, multipartPart{
+		header: fileHeader(fieldName, filepath.Base(name)),
+		open: func() (io.ReadCloser, error) {
+			return fsys.Open(name)
+		},
+		size: func() (int64, error) {
+			info, err := fs.Stat(fsys, name)
+			if err != nil {
+				return 0, err
+			}
+			return info.Size(), nil
+		},
+	})
+	return f
+}
+
+// AddReaderAt adds the file part whose content is the first size bytes of r.
+// Since r is read through [io.ReaderAt], it is read from the beginning on every attempt.
+func (f *MultipartForm) AddReaderAt(fieldName, fileName string, r io.ReaderAt, size int64) *MultipartForm {
+	f.parts = append(f.parts, multipartPart{
+		header: fileHeader(fieldName, fileName),
+		open: func() (io.ReadCloser, error) {
+			return io.NopCloser(io.NewSectionReader(r, 0, size)), nil
+		},
+		size: func() (int64, error) {
+			return size, nil
+		},
+	})
+	return f
+}
+
+// Boundary returns the boundary of the form.
+func (f *MultipartForm) Boundary() string {
+	return f.boundary
+}
+
+// ContentType returns the 'Content-Type' with the boundary.
+func (f *MultipartForm) ContentType() string {
+	return fmt.Sprintf("%s; boundary=%s", ContentTypeMultipartFormData, f.boundary)
+}
+
+// ContentLength returns the exact size of the body.
+func (f *MultipartForm) ContentLength() (int64, error) {
+	var n int64
+	for i, part := range f.parts {
+		size, err := part.size()
+		if err != nil {
+			return 0, err
+		}
+		n += int64(len(f.partHeader(i))) + size
+	}
+	return n + int64(len(f.closingBoundary())), nil
+}
+
+// Body returns a new stream of the body.
+// The sources of the parts are opened when they are reached, and closed when they are read to the end.
+func (f *MultipartForm) Body() io.ReadCloser {
+	readers := make([]func() (io.ReadCloser, error), 0, len(f.parts)*2+1)
+	for i, part := range f.parts {
+		header := f.partHeader(i)
+		readers = append(readers, func() (io.ReadCloser, error) {
+			return io.NopCloser(strings.NewReader(header)), nil
+		}, part.open)
+	}
+	closing := f.closingBoundary()
+	readers = append(readers, func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader(closing)), nil
+	})
+	return &lazyMultiReader{readers: readers}
+}
+
+// partHeader returns the boundary and the header preceding the content of the i-th part.
+func (f *MultipartForm) partHeader(i int) string {
+	b := strings.Builder{}
+	if i > 0 {
+		b.WriteString("\r\n")
+	}
+	fmt.Fprintf(&b, "--%s\r\n", f.boundary)
+	keys := make([]string, 0, len(f.parts[i].header))
+	for k := range f.parts[i].header {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		for _, v := range f.parts[i].header[k] {
+			fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+		}
+	}
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+// closingBoundary returns the closing boundary of the body.
+func (f *MultipartForm) closingBoundary() string {
+	if len(f.parts) == 0 {
+		return fmt.Sprintf("--%s--\r\n", f.boundary)
+	}
+	return fmt.Sprintf("\r\n--%s--\r\n", f.boundary)
+}
+
+// PostMultipart sends HTTP POST requests with the multipart/form-data body same as [Post].
+// The body is rebuilt from the sources of the parts on every attempt, and 'Content-Length' is set to the exact size.
+func PostMultipart(ctx context.Context, url string, form *MultipartForm, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	options = append(options, WithContentType(form.ContentType()))
+	return DoFunc(ctx, func(_ int) (*http.Request, error) {
+		contentLength, err := form.ContentLength()
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequest(http.MethodPost, url, form.Body())
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = contentLength
+		req.GetBody = func() (io.ReadCloser, error) {
+			return form.Body(), nil
+		}
+		return req, nil
+	}, options...)
+}
+
+// fileHeader returns the header of the file part.
+func fileHeader(fieldName, fileName string) textproto.MIMEHeader {
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(fieldName), escapeQuotes(fileName)))
+	header.Set("Content-Type", ContentTypeApplicationOctetStream)
+	return header
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeQuotes escapes the quotes same as [multipart.Writer.CreateFormFile].
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+// lazyMultiReader is the concatenation of the readers that are opened when they are reached.
+type lazyMultiReader struct {
+	readers []func() (io.ReadCloser, error)
+	current io.ReadCloser
+}
+
+func (r *lazyMultiReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.readers) == 0 {
+				return 0, io.EOF
+			}
+			current, err := r.readers[0]()
+			if err != nil {
+				return 0, err
+			}
+			r.current, r.readers = current, r.readers[1:]
+		}
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			r.current.Close()
+			r.current = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (r *lazyMultiReader) Close() error {
+	r.readers = nil
+	if r.current == nil {
+		return nil
+	}
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
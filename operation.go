@@ -0,0 +1,277 @@
+package r2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OperationState is the state of the long-running operation.
+type OperationState = internal.OperationState
+
+const (
+	// OperationRunning is the state that the operation is not completed yet.
+	OperationRunning = internal.OperationRunning
+	// OperationSucceeded is the state that the operation is completed successfully.
+	OperationSucceeded = internal.OperationSucceeded
+	// OperationFailed is the state that the operation is completed unsuccessfully, including canceled.
+	OperationFailed = internal.OperationFailed
+)
+
+// OperationStatus is the status of the long-running operation extracted from the polling response.
+//
+// If ResourceLocation is not empty when the operation succeeded, the final resource is fetched from it.
+type OperationStatus = internal.OperationStatus
+
+// StatusExtractor extracts the status of the long-running operation from the polling response.
+// The response body can be read, since it is restored before the response is yielded.
+type StatusExtractor = internal.StatusExtractor
+
+// ErrOperationFailed is returned when the long-running operation is completed unsuccessfully.
+var ErrOperationFailed = errors.New("r2: long-running operation failed")
+
+// WithPollInterval sets the interval between the polls of the long-running operation in [PollOperation].
+// It is used only when the response has no 'Retry-After' header.
+// Default: 1 second
+func WithPollInterval(interval time.Duration) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetPollInterval(interval)
+	}
+}
+
+// WithStatusExtractor sets the extractor of the status of the long-running operation in [PollOperation].
+// Default: [DefaultStatusExtractor]
+func WithStatusExtractor(extractor StatusExtractor) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetStatusExtractor(extractor)
+	}
+}
+
+// DefaultStatusExtractor extracts the status of the long-running operation as follows.
+//   - the response status code is 202(Accepted): running.
+//   - the response body is JSON that has 'status' field: succeeded if it is 'succeeded', 'completed' or 'done',
+//     failed if it is 'failed', 'canceled' or 'cancelled', and running otherwise.
+//     'resourceLocation' field is used as the location of the final resource.
+//   - otherwise: succeeded, and the polling response itself is regarded as the final resource.
+func DefaultStatusExtractor(res *http.Response) (OperationStatus, error) {
+	if res.StatusCode == http.StatusAccepted {
+		return OperationStatus{State: OperationRunning}, nil
+	}
+	var body struct {
+		Status           string `json:"status"`
+		ResourceLocation string `json:"resourceLocation"`
+	}
+	if res.Body != nil {
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			return OperationStatus{}, err
+		}
+		if json.Unmarshal(b, &body) != nil {
+			body.Status = ""
+		}
+	}
+	switch strings.ToLower(body.Status) {
+	case "":
+		return OperationStatus{State: OperationSucceeded}, nil
+	case "succeeded", "completed", "done":
+		return OperationStatus{State: OperationSucceeded, ResourceLocation: body.ResourceLocation}, nil
+	case "failed", "canceled", "cancelled":
+		return OperationStatus{State: OperationFailed}, nil
+	}
+	return OperationStatus{State: OperationRunning}, nil
+}
+
+// PollOperation sends the HTTP request same as [Do] that starts the long-running operation,
+// and polls the operation until it is completed.
+//
+// If the response is 202(Accepted) with 'Operation-Location' or 'Location' header,
+// or 201(Created) with 'Operation-Location' header, the URL in the header is polled with GET.
+// Each poll is retried same as [Get] on the transient errors, and the polls are repeated while the operation is running,
+// at the interval specified in 'Retry-After' header or [WithPollInterval].
+// The status of the operation is extracted by the extractor specified in [WithStatusExtractor].
+//
+// When the operation succeeded and [OperationStatus] has the resource location, the final resource is fetched with GET.
+// When the operation failed, [ErrOperationFailed] is returned with the polling response.
+//
+// And during which time it continues to return [http.Response] and error of every request.
+// The polls are terminated when the poll is interrupted by the termination condition other than success,
+// exceeds the deadline for the [context.Context] passed in the argument,
+// or the for range loop is interrupted by break.
+func PollOperation(ctx context.Context, url, method string, body io.Reader, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	prop := internal.NewR2Prop(options...)
+	extractor := prop.StatusExtractor()
+	if extractor == nil {
+		extractor = DefaultStatusExtractor
+	}
+	return func(yield func(*http.Response, error) bool) {
+		// the response is closed after it is yielded, if necessary.
+		options := append(slices.Clip(options), WithAutoCloseResponseBody(false))
+		autoClose := prop.AutoCloseResponseBody()
+
+		var last *http.Response
+		send := func(seq iter.Seq2[*http.Response, error], overrideErr func(res *http.Response) error) bool {
+			last = nil
+			for res, err := range seq {
+				if err == nil && overrideErr != nil {
+					err = overrideErr(res)
+				}
+				last = res
+				if !yieldWithAutoClose(res, err, autoClose, yield) {
+					return false
+				}
+			}
+			return true
+		}
+
+		if !send(Do(ctx, url, method, body, options...), nil) || last == nil {
+			return
+		}
+		pollURL := operationLocation(last)
+		if pollURL == "" {
+			return
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
+				return
+			case <-time.After(pollWait(last, prop.PollInterval())):
+				// no-op
+			}
+
+			var (
+				polled    *http.Response
+				status    OperationStatus
+				statusErr error
+			)
+			hook := func(_ *http.Request, res *http.Response) error {
+				polled = nil
+				if res.StatusCode >= http.StatusBadRequest {
+					return nil
+				}
+				polled = res
+				status, statusErr = extractStatus(extractor, res)
+				return nil
+			}
+			pollOptions := append(slices.Clip(options), func(p *internal.R2Prop) {
+				p.AddResponseHook(hook)
+			})
+			overrideErr := func(res *http.Response) error {
+				if res == nil || res != polled {
+					return nil
+				}
+				if statusErr != nil {
+					return statusErr
+				}
+				if status.State == OperationFailed {
+					return ErrOperationFailed
+				}
+				return nil
+			}
+			if !send(Get(ctx, pollURL, pollOptions...), overrideErr) {
+				return
+			}
+			if last == nil || last != polled || statusErr != nil {
+				return
+			}
+			switch status.State {
+			case OperationRunning:
+				continue
+			case OperationSucceeded:
+				if status.ResourceLocation == "" {
+					return
+				}
+				resourceURL, err := resolveLocation(last, status.ResourceLocation)
+				if err != nil {
+					slog.Default().WarnContext(
+						ctx,
+						"[r2]: server returned an invalid resource location.",
+						slog.String("resource-location", status.ResourceLocation),
+						slog.Any("error", err))
+					return
+				}
+				send(Get(ctx, resourceURL, options...), nil)
+			}
+			return
+		}
+	}
+}
+
+// extractStatus extracts the status of the long-running operation from the response.
+// The response body is replaced with the one that can be read again.
+func extractStatus(extractor StatusExtractor, res *http.Response) (OperationStatus, error) {
+	copiedRes, err := bufferResponseBody(res)
+	if err != nil {
+		return OperationStatus{}, err
+	}
+	return extractor(copiedRes)
+}
+
+// operationLocation returns the URL to poll the long-running operation started by the response.
+// It returns empty string if the operation is not started.
+func operationLocation(res *http.Response) string {
+	location := res.Header.Get(internal.ResponseHeaderKeyOperationLocation)
+	switch res.StatusCode {
+	case http.StatusAccepted:
+		if location == "" {
+			location = res.Header.Get(internal.ResponseHeaderKeyLocation)
+		}
+	case http.StatusCreated:
+		// no-op
+	default:
+		return ""
+	}
+	if location == "" {
+		return ""
+	}
+	resolved, err := resolveLocation(res, location)
+	if err != nil {
+		return ""
+	}
+	return resolved
+}
+
+// resolveLocation resolves the location relative to the URL of the request the response was returned from.
+func resolveLocation(res *http.Response, location string) (string, error) {
+	if res.Request == nil || res.Request.URL == nil {
+		u, err := url.Parse(location)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
+	u, err := res.Request.URL.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+// pollWait returns the duration until the next poll conforming to 'Retry-After' header of the response.
+// 'Retry-After' is either the seconds, the HTTP date or the duration such as '1s'.
+func pollWait(res *http.Response, interval time.Duration) time.Duration {
+	retryAfter := res.Header.Get(internal.ResponseHeaderKeyRetryAfter)
+	if retryAfter == "" {
+		return interval
+	}
+	if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(retryAfter); err == nil {
+		return max(time.Until(at), 0)
+	}
+	if wait, err := time.ParseDuration(retryAfter); err == nil && wait >= 0 {
+		return wait
+	}
+	return interval
+}
@@ -0,0 +1,274 @@
+package r2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"iter"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PageStrategy returns the URL of the next page from the response of the current page.
+// If the current page is the last one, it returns empty string.
+// The response body can be read, since it is restored before the response is yielded.
+type PageStrategy func(res *http.Response) (string, error)
+
+// Pages sends HTTP Get requests to every page starting from firstURL,
+// following the next page returned by strategy.
+//
+// Each page is sent same as [Get], so that the failed page is retried by itself, rather than from the first page,
+// until the [termination condition] is satisfied.
+// If the page is not succeeded in the end, the iteration is terminated without sending the next page.
+// The iteration can be resumed by starting Pages again with the URL of the failed page, i.e. [http.Response.Request].
+//
+// And during which time it continues to return [http.Response] and error of every request.
+// The iteration is terminated when the last page is reached, the page is interrupted by the termination condition other than success,
+// strategy returns an error, exceeds the deadline for the [context.Context] passed in the argument,
+// or the for range loop is interrupted by break.
+//
+// [termination condition]: https://github.com/miyamo2/r2?tab=readme-ov-file#termination-conditions
+func Pages(ctx context.Context, firstURL string, strategy PageStrategy, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	prop := internal.NewR2Prop(options...)
+	return func(yield func(*http.Response, error) bool) {
+		// the response is closed after it is yielded, if necessary.
+		options := append(slices.Clip(options), WithAutoCloseResponseBody(false))
+		autoClose := prop.AutoCloseResponseBody()
+
+		for pageURL := firstURL; pageURL != ""; {
+			var (
+				paged   *http.Response
+				next    string
+				nextErr error
+			)
+			hook := func(_ *http.Request, res *http.Response) error {
+				paged = nil
+				if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+					return nil
+				}
+				paged = res
+				next, nextErr = nextPage(strategy, res)
+				return nil
+			}
+			pageOptions := append(slices.Clip(options), func(p *internal.R2Prop) {
+				p.AddResponseHook(hook)
+			})
+
+			var last *http.Response
+			for res, err := range Get(ctx, pageURL, pageOptions...) {
+				if err == nil && res != nil && res == paged {
+					err = nextErr
+				}
+				last = res
+				if !yieldWithAutoClose(res, err, autoClose, yield) {
+					return
+				}
+			}
+			if last == nil || last != paged || nextErr != nil || next == pageURL {
+				return
+			}
+			pageURL = next
+		}
+	}
+}
+
+// nextPage returns the URL of the next page with strategy.
+func nextPage(strategy PageStrategy, res *http.Response) (string, error) {
+	copiedRes, err := bufferResponseBody(res)
+	if err != nil {
+		return "", err
+	}
+	next, err := strategy(copiedRes)
+	if err != nil || next == "" {
+		return "", err
+	}
+	return resolveLocation(res, next)
+}
+
+// LinkNextStrategy returns the [PageStrategy] that follows the link whose relation type is 'next'
+// in 'Link' header(RFC 8288).
+func LinkNextStrategy() PageStrategy {
+	return func(res *http.Response) (string, error) {
+		for _, link := range res.Header.Values("Link") {
+			for target, params := range parseLinks(link) {
+				if slices.Contains(strings.Fields(strings.ToLower(params["rel"])), "next") {
+					return target, nil
+				}
+			}
+		}
+		return "", nil
+	}
+}
+
+// CursorStrategy returns the [PageStrategy] that sets the cursor at the path of the JSON response body
+// to the query parameter param of the current page.
+// If the cursor is absent, null or empty, the current page is the last one.
+//
+// The path is the dot-separated keys and indexes such as '$.meta.next_cursor' or 'meta.next_cursor'.
+func CursorStrategy(path, param string) PageStrategy {
+	return func(res *http.Response) (string, error) {
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			return "", err
+		}
+		raw, err := internal.LookupJSONPath(b, path)
+		if err != nil {
+			return "", nil
+		}
+		var cursor any
+		if err := json.Unmarshal(raw, &cursor); err != nil {
+			return "", err
+		}
+		var value string
+		switch cursor := cursor.(type) {
+		case nil:
+			return "", nil
+		case string:
+			value = cursor
+		default:
+			value = string(raw)
+		}
+		if value == "" {
+			return "", nil
+		}
+		u, err := requestURL(res)
+		if err != nil {
+			return "", err
+		}
+		return withQuery(u, param, value), nil
+	}
+}
+
+// OffsetStrategy returns the [PageStrategy] that increments the query parameter param of the current page
+// by the number of the items at itemsPath of the JSON response body, until the page is empty.
+// If param is absent in the first page, the offset is regarded as 0.
+//
+// itemsPath is the path to the array same as [CursorStrategy]. If empty, the response body itself is the array.
+func OffsetStrategy(param, itemsPath string) PageStrategy {
+	return func(res *http.Response) (string, error) {
+		n, err := countItems(res.Body, itemsPath)
+		if err != nil || n == 0 {
+			return "", err
+		}
+		u, err := requestURL(res)
+		if err != nil {
+			return "", err
+		}
+		offset, err := queryInt(u, param, 0)
+		if err != nil {
+			return "", err
+		}
+		return withQuery(u, param, strconv.Itoa(offset+n)), nil
+	}
+}
+
+// PageNumberStrategy returns the [PageStrategy] that increments the query parameter param of the current page by 1,
+// until the items at itemsPath of the JSON response body is empty.
+// If param is absent in the first page, the page number is regarded as 1.
+//
+// itemsPath is the same as [OffsetStrategy].
+func PageNumberStrategy(param, itemsPath string) PageStrategy {
+	return func(res *http.Response) (string, error) {
+		n, err := countItems(res.Body, itemsPath)
+		if err != nil || n == 0 {
+			return "", err
+		}
+		u, err := requestURL(res)
+		if err != nil {
+			return "", err
+		}
+		page, err := queryInt(u, param, 1)
+		if err != nil {
+			return "", err
+		}
+		return withQuery(u, param, strconv.Itoa(page+1)), nil
+	}
+}
+
+// parseLinks parses the value of 'Link' header, and yields the target and the parameters of each link.
+func parseLinks(value string) iter.Seq2[string, map[string]string] {
+	return func(yield func(string, map[string]string) bool) {
+		for {
+			start := strings.IndexByte(value, '<')
+			if start < 0 {
+				return
+			}
+			end := strings.IndexByte(value[start:], '>')
+			if end < 0 {
+				return
+			}
+			target := value[start+1 : start+end]
+			value = value[start+end+1:]
+
+			params := map[string]string{}
+			rest, _, _ := strings.Cut(value, "<")
+			for _, param := range strings.Split(rest, ";") {
+				key, v, ok := strings.Cut(param, "=")
+				if !ok {
+					continue
+				}
+				key = strings.ToLower(strings.TrimSpace(key))
+				params[key] = strings.Trim(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(v), ",")), `"`)
+			}
+			if !yield(target, params) {
+				return
+			}
+		}
+	}
+}
+
+// countItems returns the number of the items at the path of the JSON body.
+func countItems(body io.Reader, path string) (int, error) {
+	b, err := io.ReadAll(body)
+	if err != nil {
+		return 0, err
+	}
+	if len(strings.TrimSpace(string(b))) == 0 {
+		return 0, nil
+	}
+	raw, err := internal.LookupJSONPath(b, path)
+	if err != nil {
+		return 0, err
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return 0, errors.Join(fmt.Errorf("r2: items at '%s' is not an array", path), err)
+	}
+	return len(items), nil
+}
+
+// requestURL returns the URL of the request the response was returned from.
+func requestURL(res *http.Response) (*url.URL, error) {
+	if res.Request == nil || res.Request.URL == nil {
+		return nil, errors.New("r2: the request of the response is unknown")
+	}
+	return res.Request.URL, nil
+}
+
+// queryInt returns the integer value of the query parameter, or defaultValue if it is absent.
+func queryInt(u *url.URL, param string, defaultValue int) (int, error) {
+	value := u.Query().Get(param)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("r2: query parameter '%s' is not an integer: %w", param, err)
+	}
+	return n, nil
+}
+
+// withQuery returns the URL whose query parameter param is set to value.
+func withQuery(u *url.URL, param, value string) string {
+	copied := *u
+	query := copied.Query()
+	query.Set(param, value)
+	copied.RawQuery = query.Encode()
+	return copied.String()
+}
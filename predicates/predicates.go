@@ -0,0 +1,180 @@
+/*
+Package predicates provides composable [r2.TerminationCondition] for [r2.WithTerminateIf].
+
+Since the conditions are checked against the copy of the response, the response body yielded to the consumer is left unread.
+
+	opts := []r2.Option{
+		r2.WithTerminateIf(predicates.AllOf(
+			predicates.StatusIn(http.StatusOK),
+			predicates.JSONPathEquals("$.status", "done"),
+		)),
+	}
+*/
+package predicates
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/miyamo2/r2"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"net/http"
+	"reflect"
+	"slices"
+)
+
+// StatusIn returns the condition that is satisfied when the response status code is one of the codes.
+func StatusIn(codes ...int) r2.TerminationCondition {
+	return func(res *http.Response, _ error) bool {
+		return res != nil && slices.Contains(codes, res.StatusCode)
+	}
+}
+
+// HeaderEquals returns the condition that is satisfied when the response header has the value.
+// If the header has multiple values, any of them is compared.
+func HeaderEquals(key, value string) r2.TerminationCondition {
+	return func(res *http.Response, _ error) bool {
+		return res != nil && slices.Contains(res.Header.Values(key), value)
+	}
+}
+
+// HeaderPresent returns the condition that is satisfied when the response header is present.
+func HeaderPresent(key string) r2.TerminationCondition {
+	return func(res *http.Response, _ error) bool {
+		return res != nil && len(res.Header.Values(key)) > 0
+	}
+}
+
+// BodyContains returns the condition that is satisfied when the response body contains substr.
+func BodyContains(substr string) r2.TerminationCondition {
+	return func(res *http.Response, _ error) bool {
+		b, ok := readBody(res)
+		return ok && bytes.Contains(b, []byte(substr))
+	}
+}
+
+// JSONPathEquals returns the condition that is satisfied when the value at the path of the JSON response body equals value.
+//
+// The path is the dot-separated keys and indexes such as '$.items[0].status' or 'items.0.status'.
+// Values are compared after both of them are converted to JSON, so that 1 equals 1.0.
+func JSONPathEquals(path string, value any) r2.TerminationCondition {
+	return func(res *http.Response, _ error) bool {
+		b, ok := readBody(res)
+		if !ok {
+			return false
+		}
+		raw, err := internal.LookupJSONPath(b, path)
+		if err != nil {
+			return false
+		}
+		var got, want any
+		if err := json.Unmarshal(raw, &got); err != nil {
+			return false
+		}
+		wantJSON, err := json.Marshal(value)
+		if err != nil {
+			return false
+		}
+		if err := json.Unmarshal(wantJSON, &want); err != nil {
+			return false
+		}
+		return reflect.DeepEqual(got, want)
+	}
+}
+
+// JSONField returns the condition that is satisfied when the value at the path of the JSON response body,
+// decoded into T, satisfies match.
+// The path is the same as [JSONPathEquals].
+func JSONField[T any](path string, match func(T) bool) r2.TerminationCondition {
+	return func(res *http.Response, _ error) bool {
+		b, ok := readBody(res)
+		if !ok {
+			return false
+		}
+		raw, err := internal.LookupJSONPath(b, path)
+		if err != nil {
+			return false
+		}
+		var v T
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return false
+		}
+		return match(v)
+	}
+}
+
+// AnyOf returns the condition that is satisfied when any of the conditions is satisfied.
+// Each condition reads the response body from the beginning.
+func AnyOf(conds ...r2.TerminationCondition) r2.TerminationCondition {
+	return func(res *http.Response, err error) bool {
+		for i, res := range replay(res, len(conds)) {
+			if conds[i](res, err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// AllOf returns the condition that is satisfied when all the conditions are satisfied.
+// Each condition reads the response body from the beginning.
+func AllOf(conds ...r2.TerminationCondition) r2.TerminationCondition {
+	return func(res *http.Response, err error) bool {
+		for i, res := range replay(res, len(conds)) {
+			if !conds[i](res, err) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Not returns the condition that is satisfied when cond is not satisfied.
+func Not(cond r2.TerminationCondition) r2.TerminationCondition {
+	return func(res *http.Response, err error) bool {
+		return !cond(res, err)
+	}
+}
+
+// readBody reads the response body.
+// It returns false if there is no response body or it could not be read.
+func readBody(res *http.Response) ([]byte, bool) {
+	if res == nil || res.Body == nil {
+		return nil, false
+	}
+	b, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// replay returns n copies of the response, each of which has the body that can be read from the beginning.
+func replay(res *http.Response, n int) []*http.Response {
+	copies := make([]*http.Response, n)
+	if res == nil || res.Body == nil || res.Body == http.NoBody {
+		for i := range copies {
+			copies[i] = res
+		}
+		return copies
+	}
+	b, err := io.ReadAll(res.Body)
+	for i := range copies {
+		copied := *res
+		copied.Body = io.NopCloser(io.MultiReader(bytes.NewReader(b), &errReader{err: err}))
+		copies[i] = &copied
+	}
+	return copies
+}
+
+// errReader returns err, or [io.EOF] if err is nil.
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read(_ []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	return 0, io.EOF
+}
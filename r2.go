@@ -6,6 +6,8 @@ package r2
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/miyamo2/r2/internal"
 	"io"
 	"iter"
@@ -43,6 +45,7 @@ const (
 	ContentTypeTextHTML                  = "text/html"
 	ContentTypeTextCSS                   = "text/css"
 	ContentTypeTextJavaScript            = "text/javascript"
+	ContentTypeTextEventStream           = "text/event-stream"
 	ContentTypeApplicationJavaScript     = "application/javascript"
 	ContentTypeApplicationOctetStream    = "application/octet-stream"
 	ContentTypeApplicationMsgPack        = "application/x-msgpack"
@@ -65,6 +68,7 @@ const (
 // Head sends HTTP HEAD requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
@@ -78,6 +82,7 @@ func Head(ctx context.Context, url string, options ...internal.Option) iter.Seq2
 // Get sends HTTP GET requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
@@ -91,6 +96,7 @@ func Get(ctx context.Context, url string, options ...internal.Option) iter.Seq2[
 // Post sends HTTP POST requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
@@ -104,6 +110,7 @@ func Post(ctx context.Context, url string, body io.Reader, options ...internal.O
 // PostForm sends HTTP POST requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
@@ -118,6 +125,7 @@ func PostForm(ctx context.Context, url string, data url.Values, options ...inter
 // Put sends HTTP PUT requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
@@ -131,6 +139,7 @@ func Put(ctx context.Context, url string, body io.Reader, options ...internal.Op
 // Patch sends HTTP PATCH requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
@@ -144,6 +153,7 @@ func Patch(ctx context.Context, url string, body io.Reader, options ...internal.
 // Delete sends HTTP DELETE requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
@@ -157,18 +167,21 @@ func Delete(ctx context.Context, url string, body io.Reader, options ...internal
 // Do send HTTP requests until one of the following conditions is satisfied.
 //   - request succeeded and no termination condition is specified by [WithTerminateIf].
 //   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
 //   - response status code is a 4xx(client error) other than 429(Too Many Request).
 //   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
 //   - exceeds the deadline for the [context.Context] passed in the argument.
 //   - when the for range loop is interrupted by break.
 //
 // And during which time it continues to return [http.Response] and error.
+// If the request can not be created, the error is returned once.
 func Do(ctx context.Context, url, method string, body io.Reader, options ...internal.Option) iter.Seq2[*http.Response, error] {
 	prop := internal.NewR2Prop(options...)
-	client := prop.Client()
 	req, err := prop.NewRequestFunc()(method, url, body)
 	if err != nil {
-		return noopSeq
+		return func(yield func(*http.Response, error) bool) {
+			yield(nil, err)
+		}
 	}
 	if header := prop.Header(); header != nil {
 		req.Header = header
@@ -176,34 +189,210 @@ func Do(ctx context.Context, url, method string, body io.Reader, options ...inte
 	if contentType := prop.ContentType(); contentType != "" && !slices.Contains([]string{http.MethodGet, http.MethodHead}, method) {
 		req.Header.Set("Content-Type", contentType)
 	}
-	maxReqTimes := prop.MaxRequestTimes()
+	run := func(ctx context.Context, yield func(*http.Response, error) bool) {
+		maxReqTimes := prop.MaxRequestTimes()
+		getBody, cleanup, err := rewindBody(req, body, prop.SpoolThreshold())
+		defer cleanup()
+		if err != nil {
+			slog.Default().WarnContext(ctx, "[r2]: request body was impossible to rewind, so the request is performed only once.", slog.Any("error", err))
+			maxReqTimes = 1
+		}
 
-	getBody, err := rewindBody(req)
-	if err != nil {
-		slog.Default().WarnContext(ctx, "[r2]: request body was impossible to rewind, so the request is performed only once.", slog.Any("error", err))
-		maxReqTimes = 1
+		newRequest := func(attempt int) (*http.Request, error) {
+			if attempt > 0 && getBody != nil {
+				body, err := getBody()
+				if err != nil {
+					return nil, fmt.Errorf("failed to rewind request body: %w", err)
+				}
+				req.Body = body
+			}
+			return req, nil
+		}
+		iterate(ctx, prop, maxReqTimes, newRequest, yield)
+	}
+	return func(yield func(*http.Response, error) bool) {
+		if key, ok := coalescingKey(prop, req); ok {
+			coalesce(ctx, key, run, prop.AutoCloseResponseBody(), yield)
+			return
+		}
+		run(ctx, yield)
 	}
+}
+
+// DoFunc sends HTTP requests created by newRequest until one of the following conditions is satisfied.
+//   - request succeeded and no termination condition is specified by [WithTerminateIf].
+//   - condition that specified in [WithTerminateIf] is satisfied.
+//   - classifier that specified in [WithClassifier] returns [Stop] or [Fail].
+//   - response status code is a 4xx(client error) other than 429(Too Many Request).
+//   - maximum number of requests specified in [WithMaxRequestAttempts] is reached.
+//   - exceeds the deadline for the [context.Context] passed in the argument.
+//   - when the for range loop is interrupted by break.
+//   - newRequest returns an error, which is returned as the last error.
+//
+// And during which time it continues to return [http.Response] and error.
+//
+// newRequest is called before every request with the number of the attempt starting from 0,
+// so that the request can differ on each attempt, e.g. a fresh nonce or a re-presigned URL.
+// Since the request body is never re-sent, it does not need to be rewindable.
+// The headers specified in [WithHeader] and [WithContentType] are added to the created request.
+func DoFunc(ctx context.Context, newRequest func(attempt int) (*http.Request, error), options ...internal.Option) iter.Seq2[*http.Response, error] {
+	prop := internal.NewR2Prop(options...)
 	return func(yield func(*http.Response, error) bool) {
-		i := 0
-		for {
-			res, err := requestWithTimeout(ctx, client, *req, prop.Period(), prop.Aspect())
+		iterate(ctx, prop, prop.MaxRequestTimes(), func(attempt int) (*http.Request, error) {
+			req, err := newRequest(attempt)
+			if err != nil {
+				return nil, err
+			}
+			header, contentType := prop.Header(), prop.ContentType()
+			if header == nil && contentType == "" {
+				return req, nil
+			}
+			cloneHeader(req)
+			for k, v := range header {
+				req.Header[k] = v
+			}
+			if contentType != "" && !slices.Contains([]string{http.MethodGet, http.MethodHead}, req.Method) {
+				req.Header.Set("Content-Type", contentType)
+			}
+			return req, nil
+		}, yield)
+	}
+}
+
+// iterate sends HTTP requests created by newRequest until the termination condition is satisfied,
+// and yields the responses and errors.
+func iterate(ctx context.Context, prop internal.R2Prop, maxReqTimes int, newRequest func(attempt int) (*http.Request, error), yield func(*http.Response, error) bool) {
+	do := transport(prop)
+	cache := newResponseCache(prop)
+	// staleIfError returns the stale response served as the last response when every attempt failed.
+	staleIfError := func(req *http.Request, fromCache bool) *http.Response {
+		if cache == nil || fromCache {
+			return nil
+		}
+		stale := cache.staleIfError(req)
+		if stale != nil {
+			slog.Default().WarnContext(ctx, "[r2]: every attempt failed, and the stale response is served.", slog.String("url", req.URL.String()))
+		}
+		return stale
+	}
+	// yieldStale serves the stale response after the iterator is interrupted without the failure.
+	yieldStale := func(req *http.Request, fromCache bool) {
+		if stale := staleIfError(req, fromCache); stale != nil {
+			yieldWithAutoClose(stale, nil, prop.AutoCloseResponseBody(), yield)
+		}
+	}
+	i := 0
+	lookedUp := false
+	for {
+		req, err := newRequest(i)
+		if err != nil {
+			slog.Default().WarnContext(ctx, "[r2]: failed to prepare the request.", slog.Any("error", err))
+			yield(nil, err)
+			return
+		}
+		attemptReq := *req
+		var (
+			res *http.Response
+			key string
+			// fromCache reports whether res is the stored response, i.e. the fresh one or the one replacing 304(Not Modified).
+			fromCache bool
+			// cached reports whether res is the fresh stored response served without sending the request.
+			cached bool
+		)
+		if cache != nil {
+			if !lookedUp {
+				lookedUp = true
+				res = cache.lookup(&attemptReq)
+				fromCache, cached = res != nil, res != nil
+			}
+			if !cached {
+				cache.prepare(&attemptReq)
+			}
+		}
+		if !cached {
+			if pool := prop.KeyPool(); pool != nil {
+				var keyErr error
+				if key, keyErr = useKeyFromPool(ctx, pool, &attemptReq); keyErr != nil {
+					slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", keyErr))
+					yieldStale(&attemptReq, false)
+					return
+				}
+			}
+			res, err = requestWithTimeout(ctx, do, attemptReq, prop.Period(), prop.Aspect())
+			if cache != nil && err == nil && res != nil {
+				notModified := res.StatusCode == http.StatusNotModified
+				res = cache.update(&attemptReq, res)
+				fromCache = notModified && res.StatusCode != http.StatusNotModified
+			}
+		}
 
-			var terminateByResponseValue *bool
-			if cond := prop.TerminationCondition(); cond != nil {
-				terminateByResponseValue = checkTerminationConditionAreSatisfied(ctx, res, err, cond)
+		var inspectionErr error
+		if err == nil && res != nil {
+			if inspectionErr = inspectResponse(prop, req, res); inspectionErr != nil {
+				err = inspectionErr
 			}
-			if !yieldWithAutoClose(res, err, prop.AutoCloseResponseBody(), yield) {
+		}
+
+		var decision Decision
+		if inspectionErr != nil && retryOnInspectionError(prop, inspectionErr) {
+			// the response is broken, so it is retried regardless of the status code and the classifier.
+			decision = Retry()
+		} else if classifier := prop.Classifier(); classifier != nil {
+			decision = classifyResponse(ctx, &prop, res, err, Attempt{Number: i, Request: &attemptReq}, classifier)
+		}
+		if decision.Action == internal.ActionFail {
+			err = decision.Err
+		}
+		if lastFailure(decision, res, err, i, maxReqTimes) {
+			if stale := staleIfError(&attemptReq, fromCache); stale != nil {
+				// the stale response is served in place of the failure.
+				if res != nil && res.Body != nil {
+					res.Body.Close()
+				}
+				yieldWithAutoClose(stale, nil, prop.AutoCloseResponseBody(), yield)
 				return
 			}
+		}
+		watchRetryRequest(res)
+		if !yieldWithAutoClose(res, err, prop.AutoCloseResponseBody(), yield) {
+			unwatchRetryRequest(res)
+			return
+		}
+		if retry := takeRetryRequest(res); retry.requested {
+			slog.Default().WarnContext(
+				ctx,
+				"[r2]: retry requested by the consumer.",
+				slog.String("url", req.URL.String()),
+				slog.Any("cause", retry.cause))
+			if res.Body != nil {
+				res.Body.Close()
+			}
+			decision = Retry()
+		}
+		switch decision.Action {
+		case internal.ActionStop:
+			return
+		case internal.ActionFail:
+			return
+		case internal.ActionRetry, internal.ActionRetryAfter:
+			if cached {
+				// the stored response is not accepted, so that it is revalidated with the conditional request without waiting.
+				i++
+				if maxReqTimes != 0 && i == maxReqTimes {
+					return
+				}
+				continue
+			}
+		}
 
-			wait := prop.Interval()
-			if res != nil {
-				switch res.StatusCode {
-				case http.StatusTooManyRequests:
-					retryAfter := res.Header.Get(internal.ResponseHeaderKeyRetryAfter)
-					if retryAfter == "" {
-						break
-					}
+		wait := prop.Interval()
+		rotateKey := false
+		if decision.Action == internal.ActionRetryAfter {
+			wait = decision.Wait
+		} else if res != nil {
+			switch res.StatusCode {
+			case http.StatusTooManyRequests:
+				if retryAfter := res.Header.Get(internal.ResponseHeaderKeyRetryAfter); retryAfter != "" {
 					if wait, err = time.ParseDuration(retryAfter); err != nil {
 						// If err is not nil, wait is surely assigned 0.
 						slog.Default().WarnContext(
@@ -212,51 +401,72 @@ func Do(ctx context.Context, url, method string, body io.Reader, options ...inte
 							slog.String("url", req.URL.String()),
 							slog.String("retry-after", retryAfter),
 							slog.Any("error", err))
-						break
 					}
-				default:
-					if res.StatusCode >= http.StatusBadRequest && res.StatusCode < http.StatusInternalServerError {
-						dumpRes, _ := httputil.DumpResponse(res, true)
-						slog.Default().WarnContext(
-							ctx,
-							"[r2]: interrupted with 4xx client error.",
-							slog.String("url", req.URL.String()),
-							slog.String("method", req.Method),
-							slog.String("response", string(dumpRes)))
-						return
-					}
-					if terminateByResponseValue != nil {
-						if *terminateByResponseValue {
-							return
-						}
-					} else if res.StatusCode < http.StatusBadRequest {
-						return
+				}
+				if key != "" {
+					// Instead of waiting, the key cools down and the next request is sent with another key.
+					cooldown := wait
+					if cooldown == 0 {
+						cooldown = backOff(i)
 					}
+					prop.KeyPool().Limit(key, cooldown)
+					wait, rotateKey = 0, true
 				}
-			}
-
-			if wait == 0 {
-				wait = backOff(i)
-			}
-			select {
-			case <-ctx.Done():
-				slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
-				return
-			case <-time.After(wait):
-				// no-op
-			}
-			if getBody != nil {
-				if req.Body, err = getBody(); err != nil {
-					slog.Default().WarnContext(ctx, "[r2]: failed to rewind request body.", slog.Any("error", err))
+			default:
+				if decision.Action == internal.ActionRetry {
+					break
+				}
+				if res.StatusCode >= http.StatusBadRequest && res.StatusCode < http.StatusInternalServerError {
+					dumpRes, _ := httputil.DumpResponse(res, true)
+					slog.Default().WarnContext(
+						ctx,
+						"[r2]: interrupted with 4xx client error.",
+						slog.String("url", req.URL.String()),
+						slog.String("method", req.Method),
+						slog.String("response", string(dumpRes)))
+					return
+				}
+				if res.StatusCode < http.StatusBadRequest {
 					return
 				}
 			}
-			i++
-			if maxReqTimes != 0 && i == maxReqTimes {
-				return
-			}
+		}
+
+		if wait == 0 && !rotateKey && decision.Action != internal.ActionRetryAfter {
+			wait = backOff(i)
+		}
+		select {
+		case <-ctx.Done():
+			slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
+			yieldStale(&attemptReq, fromCache)
+			return
+		case <-time.After(wait):
+			// no-op
+		}
+		i++
+		if maxReqTimes != 0 && i == maxReqTimes {
+			return
+		}
+	}
+}
+
+// lastFailure reports whether the attempt is the failure terminating the iterator.
+// The retry requested by the consumer after the response is yielded is not taken into account.
+func lastFailure(decision Decision, res *http.Response, err error, attempt, maxReqTimes int) bool {
+	switch decision.Action {
+	case internal.ActionStop:
+		return false
+	case internal.ActionFail:
+		return true
+	case internal.ActionDefault:
+		if res != nil && res.StatusCode < http.StatusBadRequest {
+			return false
+		}
+		if res != nil && res.StatusCode >= http.StatusBadRequest && res.StatusCode < http.StatusInternalServerError && res.StatusCode != http.StatusTooManyRequests {
+			return true
 		}
 	}
+	return maxReqTimes != 0 && attempt+1 == maxReqTimes
 }
 
 // WithHttpClient sets a custom HTTP client for the request.
@@ -306,10 +516,11 @@ func WithPeriod(period time.Duration) internal.Option {
 }
 
 // WithTerminateIf sets the termination condition of the iterator that references the response.
+//
+// It is the [Classifier] that stops when the condition is satisfied, and retries the successful response otherwise.
+// So it replaces the classifier specified in [WithClassifier].
 func WithTerminateIf(terminationCondition TerminationCondition) internal.Option {
-	return func(p *internal.R2Prop) {
-		p.SetTerminationCondition(terminationCondition)
-	}
+	return WithClassifier(terminateIf(terminationCondition))
 }
 
 // WithAspect sets the behavior to the pre-request/post-request.
@@ -331,8 +542,32 @@ type requestResult struct {
 	err error
 }
 
+// transport returns the function that sends the request with the behaviors specified in the options.
+func transport(prop internal.R2Prop) func(req *http.Request) (*http.Response, error) {
+	do := prop.Client().Do
+	if prop.ContentDigest() != "" || prop.MessageSignature() != nil {
+		do = signingTransport(prop.ContentDigest(), prop.MessageSignature(), do)
+	}
+	// The credential is set before signing, so that it can be covered by the signature.
+	if provider := prop.CredentialProvider(); provider != nil {
+		do = credentialTransport(provider, do)
+	}
+	return do
+}
+
+// cloneHeader replaces the request header with its copy.
+//
+// The header may be shared with the other attempts or the caller, so it is never modified in place.
+func cloneHeader(req *http.Request) {
+	if req.Header == nil {
+		req.Header = http.Header{}
+		return
+	}
+	req.Header = req.Header.Clone()
+}
+
 // requestWithTimeout sends a request with a timeout.
-func requestWithTimeout(ctx context.Context, client internal.HttpClient, req http.Request, period time.Duration, aspect Aspect) (*http.Response, error) {
+func requestWithTimeout(ctx context.Context, do func(req *http.Request) (*http.Response, error), req http.Request, period time.Duration, aspect Aspect) (*http.Response, error) {
 	cancel := func() {
 		// no-op
 	}
@@ -344,7 +579,7 @@ func requestWithTimeout(ctx context.Context, client internal.HttpClient, req htt
 	resultCh := make(chan requestResult, 1)
 	go func() {
 		defer close(resultCh)
-		res, err := aspect(req.WithContext(ctx), client.Do)
+		res, err := aspect(req.WithContext(ctx), do)
 		resultCh <- requestResult{res, err}
 	}()
 
@@ -361,12 +596,13 @@ func backOff(i int) time.Duration {
 	return rand.N[time.Duration](time.Second * time.Duration(math.Pow(2, float64(i+1))))
 }
 
-// rewindBody returns an [internal.GetBodyFunc].
-func rewindBody(req *http.Request) (getBody internal.GetBodyFunc, err error) {
+// rewindBody returns an [internal.GetBodyFunc], and the function that releases the resources used to rewind.
+func rewindBody(req *http.Request, body io.Reader, spoolThreshold int64) (getBody internal.GetBodyFunc, cleanup func(), err error) {
+	cleanup = noop
 	if req.Body == nil {
 		return func() (io.ReadCloser, error) {
 			return req.Body, nil
-		}, nil
+		}, cleanup, nil
 	}
 
 	if req.Body == http.NoBody {
@@ -379,15 +615,38 @@ func rewindBody(req *http.Request) (getBody internal.GetBodyFunc, err error) {
 		getBody = req.GetBody
 		return
 	}
-	buf := bytes.Buffer{}
-	tr := io.TeeReader(req.Body, &buf)
-	req.Body = io.NopCloser(&buf)
 
-	b, err := io.ReadAll(tr)
+	source, sized := bodySource(req, body)
+	size := int64(-1)
+	switch rewindable := source.(type) {
+	case io.ReaderAt:
+		getBody, size, err = rewindBodyWithReaderAt(rewindable)
+	case io.ReadSeeker:
+		getBody, size, err = rewindBodyWithSeeker(rewindable)
+	default:
+		if spoolThreshold > 0 {
+			getBody, cleanup, err = spoolBody(req, spoolThreshold)
+			break
+		}
+		buf := bytes.Buffer{}
+		tr := io.TeeReader(req.Body, &buf)
+		req.Body = io.NopCloser(&buf)
+
+		var b []byte
+		if b, err = io.ReadAll(tr); err == nil {
+			getBody = getBodyFromBytes(b)
+		}
+	}
 	if err != nil {
-		return nil, err
+		return nil, cleanup, err
+	}
+	if sized && size >= 0 {
+		setContentLength(req, size)
+	}
+	if req.Body, err = getBody(); err != nil {
+		return nil, cleanup, err
 	}
-	getBody = getBodyFromBytes(b)
+	req.GetBody = getBody
 	return
 }
 
@@ -398,17 +657,41 @@ func getBodyFromBytes(b []byte) internal.GetBodyFunc {
 	}
 }
 
-func noopSeq(_ func(*http.Response, error) bool) {
-	// no-op
+// inspectResponse verifies and decodes the response before it is yielded.
+func inspectResponse(prop internal.R2Prop, req *http.Request, res *http.Response) error {
+	if prop.VerifyContentDigest() && req.Method != http.MethodHead {
+		if err := verifyContentDigest(res); err != nil {
+			return err
+		}
+	}
+	for _, hook := range prop.ResponseHooks() {
+		if err := hook(req, res); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryOnInspectionError returns whether the request is retried with the error returned by [inspectResponse].
+func retryOnInspectionError(prop internal.R2Prop, err error) bool {
+	var decodeErr *DecodeError
+	if errors.As(err, &decodeErr) {
+		return prop.RetryOnDecodeError()
+	}
+	return true
 }
 
-// checkTerminationConditionAreSatisfied returns whether the termination condition specified in `WithTerminateIf` is satisfied.
+// classifyResponse classifies the response with the classifier specified in [WithClassifier] or [WithTerminateIf].
 //
-// The request body is closed after the check is completed.
-func checkTerminationConditionAreSatisfied(ctx context.Context, res *http.Response, err error, cond TerminationCondition) *bool {
-	physicalResult := false
+// The classifier receives the copy of the response, so that the response body yielded to the consumer is left unread.
+// The body of the copy is closed after the classification is completed.
+//
+// If the peek limit specified in [WithPeekLimit] is set, the classifier receives only the leading bytes of the body,
+// and the consumer receives the body that replays them followed by the rest of the original body.
+// If [WithHeaderOnlyInspection] is enabled, the body is not read at all.
+func classifyResponse(ctx context.Context, prop *internal.R2Prop, res *http.Response, err error, attempt Attempt, classifier Classifier) Decision {
 	if res == nil {
-		return &physicalResult
+		return classifier(nil, err, attempt)
 	}
 
 	copiedRes := &http.Response{
@@ -427,23 +710,28 @@ func checkTerminationConditionAreSatisfied(ctx context.Context, res *http.Respon
 		TLS:              res.TLS,
 	}
 	if res.Body == nil {
-		physicalResult = cond(copiedRes, err)
-		return &physicalResult
+		return classifier(copiedRes, err, attempt)
 	}
-	if res.Body == http.NoBody {
+	if res.Body == http.NoBody || prop.HeaderOnlyInspection() {
 		copiedRes.Body = http.NoBody
-		physicalResult = cond(copiedRes, err)
-		return &physicalResult
+		return classifier(copiedRes, err, attempt)
 	}
-	buf := bytes.Buffer{}
-	tr := io.TeeReader(res.Body, &buf)
-	res.Body = io.NopCloser(&buf)
 
-	b, err := io.ReadAll(tr)
-	if err != nil {
-		slog.Default().WarnContext(ctx, "[r2]: failed to read response body.", slog.Any("error", err))
-		physicalResult = cond(copiedRes, err)
-		return &physicalResult
+	var tr io.Reader
+	if limit := prop.PeekLimit(); limit > 0 {
+		buf := bytes.Buffer{}
+		tr = io.TeeReader(io.LimitReader(res.Body, limit), &buf)
+		res.Body = &peekedBody{Reader: io.MultiReader(&buf, res.Body), Closer: res.Body}
+	} else {
+		buf := bytes.Buffer{}
+		tr = io.TeeReader(res.Body, &buf)
+		res.Body = io.NopCloser(&buf)
+	}
+
+	b, readErr := io.ReadAll(tr)
+	if readErr != nil {
+		slog.Default().WarnContext(ctx, "[r2]: failed to read response body.", slog.Any("error", readErr))
+		return classifier(copiedRes, errors.Join(err, readErr), attempt)
 	}
 
 	copiedRes.Body = io.NopCloser(bytes.NewBuffer(b))
@@ -451,8 +739,14 @@ func checkTerminationConditionAreSatisfied(ctx context.Context, res *http.Respon
 		io.Copy(io.Discard, copiedRes.Body)
 		copiedRes.Body.Close()
 	}()
-	physicalResult = cond(copiedRes, err)
-	return &physicalResult
+	return classifier(copiedRes, err, attempt)
+}
+
+// peekedBody is the response body that replays the peeked bytes followed by the rest of the original body.
+// Closing it closes the original body.
+type peekedBody struct {
+	io.Reader
+	io.Closer
 }
 
 // yieldWithAutoClose calls yield and then closes [http.Response.Body].
@@ -0,0 +1,405 @@
+package r2
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnexpectedStatusCode is returned when the response status code is not expected.
+var ErrUnexpectedStatusCode = errors.New("r2: unexpected status code")
+
+// StreamProgress is the progress of the record stream when the connection dropped.
+type StreamProgress[T any] struct {
+	// Records is the number of the records yielded so far, excluding the CSV header.
+	Records int64
+	// Offset is the byte offset of the end of the last yielded record in the response body.
+	// If the response is 206(Partial Content), it is relative to the beginning of the whole body.
+	Offset int64
+	// Last is the last yielded record.
+	Last T
+}
+
+// ResumeFunc returns the request that continues the record stream of url from the progress.
+// [ResumeWithRange], [ResumeWithOffset] and [ResumeWithCursor] are provided.
+type ResumeFunc[T any] func(ctx context.Context, url string, progress StreamProgress[T]) (*http.Request, error)
+
+// ResumeWithRange returns the [ResumeFunc] that requests the rest of the body with 'Range' header.
+// If the server ignores 'Range' and responds with the whole body, the records yielded so far are skipped.
+func ResumeWithRange[T any]() ResumeFunc[T] {
+	return func(ctx context.Context, url string, progress StreamProgress[T]) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", progress.Offset))
+		return req, nil
+	}
+}
+
+// ResumeWithOffset returns the [ResumeFunc] that adds the number of the yielded records to the query parameter param.
+// If param is absent in url, the offset is regarded as 0.
+func ResumeWithOffset[T any](param string) ResumeFunc[T] {
+	return func(ctx context.Context, rawURL string, progress StreamProgress[T]) (*http.Request, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		offset, err := queryInt(u, param, 0)
+		if err != nil {
+			return nil, err
+		}
+		return http.NewRequestWithContext(ctx, http.MethodGet, withQuery(u, param, strconv.FormatInt(int64(offset)+progress.Records, 10)), nil)
+	}
+}
+
+// ResumeWithCursor returns the [ResumeFunc] that sets the cursor taken from the last yielded record to the query parameter param.
+func ResumeWithCursor[T any](param string, cursor func(last T) string) ResumeFunc[T] {
+	return func(ctx context.Context, rawURL string, progress StreamProgress[T]) (*http.Request, error) {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if progress.Records == 0 {
+			return http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		}
+		return http.NewRequestWithContext(ctx, http.MethodGet, withQuery(u, param, cursor(progress.Last)), nil)
+	}
+}
+
+// GetNDJSON sends HTTP Get requests same as [Get], and yields each line of the NDJSON(JSON Lines) response body decoded into T.
+// The records are decoded incrementally without buffering the whole body.
+//
+// When the connection drops in the middle of the body, it reconnects with the request created by resume,
+// and continues yielding from the record next to the last yielded one.
+// If resume is nil, the error is returned instead.
+// See also [ResumeFunc].
+func GetNDJSON[T any](ctx context.Context, url string, resume ResumeFunc[T], options ...internal.Option) iter.Seq2[T, error] {
+	return streamRecords(ctx, url, resume, decodeNDJSON[T], options...)
+}
+
+// GetJSONArray sends HTTP Get requests same as [Get], and yields each element of the JSON array response body decoded into T.
+// The records are decoded incrementally without buffering the whole body.
+//
+// The resumption is the same as [GetNDJSON].
+// If the resumed response is 206(Partial Content), it is decoded as the continuation of the array.
+func GetJSONArray[T any](ctx context.Context, url string, resume ResumeFunc[T], options ...internal.Option) iter.Seq2[T, error] {
+	return streamRecords(ctx, url, resume, decodeJSONArray[T], options...)
+}
+
+// GetCSV sends HTTP Get requests same as [Get], and yields each record of the CSV response body.
+// The records are decoded incrementally without buffering the whole body.
+//
+// If header is true, the first record of the response body is regarded as the header, and it is yielded only once.
+// The header of the resumed response is skipped, unless the response is 206(Partial Content) that has no header.
+//
+// The resumption is the same as [GetNDJSON].
+func GetCSV(ctx context.Context, url string, header bool, resume ResumeFunc[[]string], options ...internal.Option) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		headerYielded := false
+		decode := func(body io.Reader, partial bool, emit func([]string, int64, bool) bool) error {
+			skipHeader := header && !partial
+			reader := csv.NewReader(body)
+			reader.FieldsPerRecord = -1
+			for {
+				record, err := reader.Read()
+				if err == io.EOF {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				if skipHeader {
+					skipHeader = false
+					if headerYielded {
+						continue
+					}
+					headerYielded = true
+					if !emit(record, reader.InputOffset(), true) {
+						return nil
+					}
+					continue
+				}
+				if !emit(record, reader.InputOffset(), false) {
+					return nil
+				}
+			}
+		}
+		for record, err := range streamRecords(ctx, url, resume, decode, options...) {
+			if !yield(record, err) {
+				return
+			}
+		}
+	}
+}
+
+// recordDecoder decodes the records from the response body of the connection, and emits them with the byte offset of the end.
+// partial reports whether the response body is the continuation of the previous one.
+// It returns nil when the body is completed or emit returns false.
+type recordDecoder[T any] func(body io.Reader, partial bool, emit func(record T, end int64, header bool) bool) error
+
+// streamRecords sends HTTP Get requests, and yields the records decoded by decode.
+// When the connection drops, it reconnects with the request created by resume.
+func streamRecords[T any](ctx context.Context, url string, resume ResumeFunc[T], decode recordDecoder[T], options ...internal.Option) iter.Seq2[T, error] {
+	prop := internal.NewR2Prop(options...)
+	return func(yield func(T, error) bool) {
+		options := append(slices.Clip(options), WithAutoCloseResponseBody(false))
+		var progress StreamProgress[T]
+		// ranged reports whether the last request is resumed with 'Range' header.
+		ranged := false
+		newRequest := func(_ int) (*http.Request, error) {
+			return http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		}
+		for resumes := 0; ; {
+			res, err := connectStream(ctx, newRequest, options...)
+			if err != nil {
+				if ctx.Err() == nil {
+					yield(*new(T), err)
+				}
+				return
+			}
+			partial := res.StatusCode == http.StatusPartialContent
+			base, skip := int64(0), int64(0)
+			if partial {
+				base = contentRangeStart(res)
+			} else if ranged {
+				// the whole body is sent, so that the records yielded so far are skipped.
+				skip = progress.Records
+			}
+			body := &trackingReader{r: res.Body}
+			delivered, interrupted := false, false
+			err = decode(body, partial, func(record T, end int64, header bool) bool {
+				progress.Offset = base + end
+				if !header && skip > 0 {
+					skip--
+					return true
+				}
+				if !header {
+					progress.Records++
+					progress.Last = record
+				}
+				delivered = true
+				if !yield(record, nil) {
+					interrupted = true
+					return false
+				}
+				return true
+			})
+			res.Body.Close()
+			if interrupted || err == nil {
+				return
+			}
+
+			dropped := body.err != nil || errors.Is(err, io.ErrUnexpectedEOF)
+			if delivered {
+				resumes = 0
+			}
+			resumes++
+			if !dropped || resume == nil || ctx.Err() != nil || (prop.MaxRequestTimes() != 0 && resumes > prop.MaxRequestTimes()) {
+				if ctx.Err() == nil {
+					yield(*new(T), err)
+				}
+				return
+			}
+			slog.Default().WarnContext(
+				ctx,
+				"[r2]: record stream dropped.",
+				slog.String("url", url),
+				slog.Int64("records", progress.Records),
+				slog.Int64("offset", progress.Offset),
+				slog.Any("error", err))
+
+			wait := prop.Interval()
+			if wait == 0 {
+				wait = backOff(resumes - 1)
+			}
+			select {
+			case <-ctx.Done():
+				slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
+				return
+			case <-time.After(wait):
+				// no-op
+			}
+			resumed := progress
+			newRequest = func(_ int) (*http.Request, error) {
+				req, err := resume(ctx, url, resumed)
+				if err != nil {
+					return nil, err
+				}
+				ranged = req.Header.Get("Range") != ""
+				return req, nil
+			}
+		}
+	}
+}
+
+// connectStream sends the requests created by newRequest same as [DoFunc],
+// and returns the 2xx response whose body is the stream.
+func connectStream(ctx context.Context, newRequest func(attempt int) (*http.Request, error), options ...internal.Option) (*http.Response, error) {
+	res, err := lastResponse(ctx, newRequest, options...)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatusCode, res.Status)
+	}
+	return res, nil
+}
+
+// lastResponse sends the requests created by newRequest same as [DoFunc],
+// and returns the last response. The bodies of the other responses are closed.
+func lastResponse(ctx context.Context, newRequest func(attempt int) (*http.Request, error), options ...internal.Option) (*http.Response, error) {
+	var (
+		res     *http.Response
+		lastErr error
+	)
+	for r, err := range DoFunc(ctx, newRequest, options...) {
+		if res != nil && res.Body != nil {
+			res.Body.Close()
+		}
+		res, lastErr = r, err
+	}
+	if lastErr != nil {
+		if res != nil && res.Body != nil {
+			res.Body.Close()
+		}
+		return nil, lastErr
+	}
+	if res == nil {
+		return nil, ErrUnexpectedStatusCode
+	}
+	return res, nil
+}
+
+// contentRangeStart returns the first byte position of 'Content-Range' header, or 0 if it is unknown.
+func contentRangeStart(res *http.Response) int64 {
+	unit, rng, ok := strings.Cut(res.Header.Get("Content-Range"), " ")
+	if !ok || unit != "bytes" {
+		return 0
+	}
+	start, _, _ := strings.Cut(rng, "-")
+	n, err := strconv.ParseInt(start, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// decodeNDJSON decodes each line of the body as JSON.
+func decodeNDJSON[T any](body io.Reader, _ bool, emit func(T, int64, bool) bool) error {
+	reader := bufio.NewReader(body)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		offset += int64(len(line))
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			var record T
+			if decodeErr := json.Unmarshal(trimmed, &record); decodeErr != nil {
+				return decodeErr
+			}
+			if !emit(record, offset, false) {
+				return nil
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// decodeJSONArray decodes each element of the JSON array in the body.
+// If partial is true, the body is regarded as the continuation of the array after an element.
+func decodeJSONArray[T any](body io.Reader, partial bool, emit func(T, int64, bool) bool) error {
+	// skipped is the number of bytes skipped before the decoder, and prefix is the one added before the body.
+	var skipped, prefix int64
+	if partial {
+		reader := bufio.NewReader(body)
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+			skipped++
+			if b == ',' {
+				break
+			}
+			if b == ']' {
+				return nil
+			}
+			if !isJSONSpace(b) {
+				return fmt.Errorf("r2: unexpected character '%c' at the beginning of the continuation of the array", b)
+			}
+		}
+		body, prefix = io.MultiReader(strings.NewReader("["), reader), 1
+	}
+
+	decoder := json.NewDecoder(body)
+	token, err := decoder.Token()
+	if err != nil {
+		return unexpectedEOF(err)
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return fmt.Errorf("r2: response body is not a JSON array")
+	}
+	for decoder.More() {
+		var record T
+		if err := decoder.Decode(&record); err != nil {
+			return unexpectedEOF(err)
+		}
+		if !emit(record, skipped+decoder.InputOffset()-prefix, false) {
+			return nil
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		return unexpectedEOF(err)
+	}
+	return nil
+}
+
+// isJSONSpace reports whether b is the whitespace of JSON.
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
+
+// unexpectedEOF converts [io.EOF] to [io.ErrUnexpectedEOF], since the body ended in the middle of the array.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// trackingReader records the error other than [io.EOF] returned by the reader.
+type trackingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (r *trackingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if err != nil && err != io.EOF && r.err == nil {
+		r.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,340 @@
+package r2
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"sync"
+	"time"
+)
+
+// RemoteChangedError is returned by [RemoteFile] when the remote resource is changed after it is opened.
+// It wraps [ErrResourceChanged].
+type RemoteChangedError struct {
+	// URL is the url of the remote resource.
+	URL string
+	// Validator is 'ETag' or 'Last-Modified' of the resource when it is opened.
+	Validator string
+	// Err is the cause.
+	Err error
+}
+
+func (e *RemoteChangedError) Error() string {
+	return fmt.Sprintf("r2: remote resource %s is changed since %s: %v", e.URL, e.Validator, e.Err)
+}
+
+func (e *RemoteChangedError) Unwrap() error {
+	return e.Err
+}
+
+// WithBlockCache enables the block cache of [RemoteFile].
+// The reads are aligned to the blocks of blockSize bytes, and up to blocks of them are cached in LRU order.
+// Default: disabled
+func WithBlockCache(blockSize int64, blocks int) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetBlockCache(blockSize, blocks)
+	}
+}
+
+// RemoteFile is the remote resource over HTTP 'Range' requests opened by [OpenRemote].
+// It implements [io.ReaderAt], [io.ReadSeeker] and [fs.File].
+// ReadAt is safe for concurrent use, but Read and Seek share the offset.
+type RemoteFile struct {
+	ctx       context.Context
+	url       string
+	size      int64
+	modTime   time.Time
+	validator string
+	prop      internal.R2Prop
+	options   []internal.Option
+
+	mu     sync.Mutex
+	offset int64
+	closed bool
+	cache  *blockCache
+}
+
+// OpenRemote opens the remote resource of url.
+//
+// The size of the resource is probed with HEAD same as [Head], and each read is served by the GET request
+// with 'Range' guarded by 'If-Range' with 'ETag' or 'Last-Modified' of the resource, retried same as [Get].
+// When the connection drops in the middle of the body, only the rest of the range is requested again.
+// ctx is used for all the requests of the returned [RemoteFile].
+//
+// If the server does not support 'Range', [ErrRangeNotSupported] is returned.
+// If the resource is changed after it is opened, the read returns [*RemoteChangedError].
+func OpenRemote(ctx context.Context, url string, options ...internal.Option) (*RemoteFile, error) {
+	prop := internal.NewR2Prop(options...)
+	options = append(slices.Clip(options), WithAutoCloseResponseBody(false))
+
+	res, err := connectStream(ctx, func(_ int) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	}, options...)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	if res.ContentLength < 0 || res.Header.Get("Accept-Ranges") != "bytes" {
+		return nil, ErrRangeNotSupported
+	}
+	f := &RemoteFile{
+		ctx:       ctx,
+		url:       url,
+		size:      res.ContentLength,
+		validator: resumeValidator(res),
+		prop:      prop,
+		options:   options,
+	}
+	if modTime, err := http.ParseTime(res.Header.Get("Last-Modified")); err == nil {
+		f.modTime = modTime
+	}
+	if blockSize, blocks := prop.BlockCache(); blockSize > 0 {
+		f.cache = newBlockCache(blockSize, blocks)
+	}
+	return f, nil
+}
+
+// Size returns the size of the remote resource.
+func (f *RemoteFile) Size() int64 {
+	return f.size
+}
+
+// ReadAt implements [io.ReaderAt].
+func (f *RemoteFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.isClosed() {
+		return 0, fs.ErrClosed
+	}
+	return f.readAt(p, off)
+}
+
+// readAt reads len(p) bytes from off of the remote resource.
+func (f *RemoteFile) readAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("r2: negative offset")
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	end := min(off+int64(len(p)), f.size)
+	var n int
+	if f.cache == nil {
+		buf, err := f.fetch(off, end-1)
+		n = copy(p, buf)
+		if err != nil {
+			return n, err
+		}
+	} else {
+		for n < int(end-off) {
+			pos := off + int64(n)
+			index := pos / f.cache.blockSize
+			block, err := f.block(index)
+			if err != nil {
+				return n, err
+			}
+			n += copy(p[n:end-off], block[pos-index*f.cache.blockSize:])
+		}
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Read implements [io.Reader].
+func (f *RemoteFile) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if f.offset >= f.size {
+		return 0, io.EOF
+	}
+	p = p[:min(int64(len(p)), f.size-f.offset)]
+	n, err := f.readAt(p, f.offset)
+	f.offset += int64(n)
+	if errors.Is(err, io.EOF) && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements [io.Seeker].
+func (f *RemoteFile) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, fs.ErrClosed
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.New("r2: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("r2: negative position")
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// Stat implements [fs.File].
+func (f *RemoteFile) Stat() (fs.FileInfo, error) {
+	if f.isClosed() {
+		return nil, fs.ErrClosed
+	}
+	name := f.url
+	if u, err := url.Parse(f.url); err == nil {
+		name = path.Base(u.Path)
+	}
+	return &remoteFileInfo{name: name, size: f.size, modTime: f.modTime}, nil
+}
+
+// Close implements [io.Closer]. It releases the cached blocks.
+func (f *RemoteFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return fs.ErrClosed
+	}
+	f.closed = true
+	if f.cache != nil {
+		f.cache.reset()
+	}
+	return nil
+}
+
+func (f *RemoteFile) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+// block returns the block of index from the cache, or fetches it.
+func (f *RemoteFile) block(index int64) ([]byte, error) {
+	if block, ok := f.cache.get(index); ok {
+		return block, nil
+	}
+	start := index * f.cache.blockSize
+	block, err := f.fetch(start, min(start+f.cache.blockSize, f.size)-1)
+	if err != nil {
+		return nil, err
+	}
+	f.cache.put(index, block)
+	return block, nil
+}
+
+// fetch requests the range from start to end of the remote resource.
+func (f *RemoteFile) fetch(start, end int64) ([]byte, error) {
+	buf := &bufferAt{b: make([]byte, end-start+1), base: start}
+	var n int64
+	err := downloadChunk(f.ctx, f.prop, f.url, f.validator, start, end, buf, func(written int64) { n += written }, f.options...)
+	if errors.Is(err, ErrResourceChanged) {
+		err = &RemoteChangedError{URL: f.url, Validator: f.validator, Err: err}
+	}
+	return buf.b[:n], err
+}
+
+// bufferAt is the [io.WriterAt] over the byte slice which starts at base.
+type bufferAt struct {
+	b    []byte
+	base int64
+}
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	off -= b.base
+	if off < 0 || off+int64(len(p)) > int64(len(b.b)) {
+		return 0, io.ErrShortWrite
+	}
+	return copy(b.b[off:], p), nil
+}
+
+// blockCache is the LRU cache of the blocks.
+type blockCache struct {
+	blockSize int64
+	blocks    int
+
+	mu    sync.Mutex
+	order *list.List
+	items map[int64]*list.Element
+}
+
+// cachedBlock is the element of blockCache.
+type cachedBlock struct {
+	index int64
+	data  []byte
+}
+
+func newBlockCache(blockSize int64, blocks int) *blockCache {
+	return &blockCache{
+		blockSize: blockSize,
+		blocks:    blocks,
+		order:     list.New(),
+		items:     make(map[int64]*list.Element, blocks),
+	}
+}
+
+func (c *blockCache) get(index int64) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[index]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedBlock).data, true
+}
+
+func (c *blockCache) put(index int64, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[index]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[index] = c.order.PushFront(&cachedBlock{index: index, data: data})
+	for c.order.Len() > c.blocks {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*cachedBlock).index)
+	}
+}
+
+func (c *blockCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.items)
+}
+
+// remoteFileInfo implements [fs.FileInfo] for [RemoteFile].
+type remoteFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (i *remoteFileInfo) Name() string       { return i.name }
+func (i *remoteFileInfo) Size() int64        { return i.size }
+func (i *remoteFileInfo) Mode() fs.FileMode  { return 0o444 }
+func (i *remoteFileInfo) ModTime() time.Time { return i.modTime }
+func (i *remoteFileInfo) IsDir() bool        { return false }
+func (i *remoteFileInfo) Sys() any           { return nil }
@@ -0,0 +1,61 @@
+package r2
+
+import (
+	"net/http"
+	"sync"
+)
+
+// retryRequests holds the responses being yielded, and the causes of the retries requested for them.
+var retryRequests sync.Map
+
+// RetryAttempt requests the iterator to retry the attempt that res was returned from,
+// even if the response is successful or the iteration would otherwise be terminated.
+// It is called inside the for range loop, e.g. when the response body could not be decoded or was truncated.
+//
+// The retry follows the same interval, backoff and the maximum number of requests as the other retries,
+// and the response body is closed before the next request is sent.
+// cause is only used for logging and may be nil.
+//
+// It returns false if res is not the response that is currently yielded by the iterator.
+func RetryAttempt(res *http.Response, cause error) bool {
+	if res == nil {
+		return false
+	}
+	if _, ok := retryRequests.Load(res); !ok {
+		return false
+	}
+	retryRequests.Store(res, retryRequest{requested: true, cause: cause})
+	return true
+}
+
+// retryRequest is the retry requested by [RetryAttempt].
+type retryRequest struct {
+	requested bool
+	cause     error
+}
+
+// watchRetryRequest makes res acceptable to [RetryAttempt] while it is yielded.
+func watchRetryRequest(res *http.Response) {
+	if res != nil {
+		retryRequests.Store(res, retryRequest{})
+	}
+}
+
+// unwatchRetryRequest stops accepting [RetryAttempt] for res.
+func unwatchRetryRequest(res *http.Response) {
+	if res != nil {
+		retryRequests.Delete(res)
+	}
+}
+
+// takeRetryRequest stops accepting [RetryAttempt] for res, and returns the retry requested for it.
+func takeRetryRequest(res *http.Response) retryRequest {
+	if res == nil {
+		return retryRequest{}
+	}
+	v, ok := retryRequests.LoadAndDelete(res)
+	if !ok {
+		return retryRequest{}
+	}
+	return v.(retryRequest)
+}
@@ -0,0 +1,398 @@
+package r2
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Signer specifies the interface for the key that signs HTTP message signatures(RFC 9421).
+type Signer = internal.Signer
+
+// DigestAlgorithms
+const (
+	DigestAlgorithmSHA256 = "sha-256"
+	DigestAlgorithmSHA512 = "sha-512"
+)
+
+// Signature components
+const (
+	ComponentMethod        = "@method"
+	ComponentTargetURI     = "@target-uri"
+	ComponentAuthority     = "@authority"
+	ComponentScheme        = "@scheme"
+	ComponentRequestTarget = "@request-target"
+	ComponentPath          = "@path"
+	ComponentQuery         = "@query"
+	ComponentContentDigest = "content-digest"
+)
+
+const (
+	headerKeyContentDigest  = "Content-Digest"
+	headerKeySignature      = "Signature"
+	headerKeySignatureInput = "Signature-Input"
+	defaultSignatureLabel   = "sig1"
+)
+
+// ErrContentDigestMismatch is returned when the response body does not match the 'Content-Digest' header.
+var ErrContentDigestMismatch = errors.New("r2: response body does not match content-digest")
+
+// WithContentDigest sets the 'Content-Digest'(RFC 9530) header computed over the request body on every request.
+// If the request body can not be re-acquired by [http.Request.GetBody], the body is buffered in memory before sending.
+// Supported algorithms are [DigestAlgorithmSHA256] and [DigestAlgorithmSHA512].
+func WithContentDigest(algorithm string) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetContentDigest(algorithm)
+	}
+}
+
+// WithMessageSignature sets 'Signature-Input' and 'Signature' headers(RFC 9421) on every request.
+// Since the 'created' parameter changes, the request is re-signed on every attempt.
+//
+// If components are not specified, '@method', '@target-uri' and, when the request has a body, 'content-digest' are covered.
+// If 'content-digest' is covered and [WithContentDigest] is not specified, the digest is computed with [DigestAlgorithmSHA256].
+func WithMessageSignature(signer Signer, components ...string) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetMessageSignature(&internal.MessageSignature{
+			Label:      defaultSignatureLabel,
+			Signer:     signer,
+			Components: components,
+		})
+	}
+}
+
+// WithVerifyContentDigest sets whether the response body is verified against the 'Content-Digest' header.
+// If the verification fails, [ErrContentDigestMismatch] is returned and the request is retried.
+func WithVerifyContentDigest(verifyContentDigest bool) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetVerifyContentDigest(verifyContentDigest)
+	}
+}
+
+// NewEd25519Signer returns a [Signer] with the 'ed25519' algorithm.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) Signer {
+	return &ed25519Signer{keyID: keyID, key: key}
+}
+
+// NewECDSAP256Signer returns a [Signer] with the 'ecdsa-p256-sha256' algorithm.
+// The key must be on the P-256 curve, otherwise the signing fails with the error.
+func NewECDSAP256Signer(keyID string, key *ecdsa.PrivateKey) Signer {
+	return &ecdsaP256Signer{keyID: keyID, key: key}
+}
+
+// NewRSAPSSSigner returns a [Signer] with the 'rsa-pss-sha512' algorithm.
+func NewRSAPSSSigner(keyID string, key *rsa.PrivateKey) Signer {
+	return &rsaPSSSigner{keyID: keyID, key: key}
+}
+
+// NewHMACSigner returns a [Signer] with the 'hmac-sha256' algorithm.
+func NewHMACSigner(keyID string, key []byte) Signer {
+	return &hmacSigner{keyID: keyID, key: key}
+}
+
+type ed25519Signer struct {
+	keyID string
+	key   ed25519.PrivateKey
+}
+
+func (s *ed25519Signer) KeyID() string {
+	return s.keyID
+}
+
+func (s *ed25519Signer) Algorithm() string {
+	return "ed25519"
+}
+
+func (s *ed25519Signer) Sign(signatureBase []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, signatureBase), nil
+}
+
+type ecdsaP256Signer struct {
+	keyID string
+	key   *ecdsa.PrivateKey
+}
+
+func (s *ecdsaP256Signer) KeyID() string {
+	return s.keyID
+}
+
+func (s *ecdsaP256Signer) Algorithm() string {
+	return "ecdsa-p256-sha256"
+}
+
+func (s *ecdsaP256Signer) Sign(signatureBase []byte) ([]byte, error) {
+	if s.key == nil || s.key.Curve != elliptic.P256() {
+		return nil, errors.New("r2: ecdsa-p256-sha256 requires the key on the P-256 curve")
+	}
+	digest := sha256.Sum256(signatureBase)
+	r, v, err := ecdsa.Sign(rand.Reader, s.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	// RFC 9421 requires the concatenation of r and s, each of which is 32 bytes.
+	sig := make([]byte, 64)
+	r.FillBytes(sig[:32])
+	v.FillBytes(sig[32:])
+	return sig, nil
+}
+
+type rsaPSSSigner struct {
+	keyID string
+	key   *rsa.PrivateKey
+}
+
+func (s *rsaPSSSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *rsaPSSSigner) Algorithm() string {
+	return "rsa-pss-sha512"
+}
+
+func (s *rsaPSSSigner) Sign(signatureBase []byte) ([]byte, error) {
+	digest := sha512.Sum512(signatureBase)
+	return rsa.SignPSS(rand.Reader, s.key, crypto.SHA512, digest[:], &rsa.PSSOptions{
+		SaltLength: 64,
+		Hash:       crypto.SHA512,
+	})
+}
+
+type hmacSigner struct {
+	keyID string
+	key   []byte
+}
+
+func (s *hmacSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *hmacSigner) Algorithm() string {
+	return "hmac-sha256"
+}
+
+func (s *hmacSigner) Sign(signatureBase []byte) ([]byte, error) {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(signatureBase)
+	return mac.Sum(nil), nil
+}
+
+// signingTransport returns the function that sets 'Content-Digest' and the message signature before sending the request.
+func signingTransport(digestAlgorithm string, signature *internal.MessageSignature, do func(req *http.Request) (*http.Response, error)) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		cloneHeader(req)
+
+		var components []string
+		if signature != nil {
+			components = signature.Components
+			if len(components) == 0 {
+				components = []string{ComponentMethod, ComponentTargetURI}
+				if req.Body != nil && req.Body != http.NoBody {
+					components = append(components, ComponentContentDigest)
+				}
+			}
+			if digestAlgorithm == "" && slices.Contains(components, ComponentContentDigest) {
+				digestAlgorithm = DigestAlgorithmSHA256
+			}
+		}
+		if digestAlgorithm != "" {
+			digest, err := requestContentDigest(req, digestAlgorithm)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set(headerKeyContentDigest, digest)
+		}
+		if signature != nil {
+			if err := signRequest(req, signature.Label, signature.Signer, components, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+		return do(req)
+	}
+}
+
+// requestContentDigest returns the value of 'Content-Digest' header computed over the request body.
+func requestContentDigest(req *http.Request, algorithm string) (string, error) {
+	h, err := newDigestHash(algorithm)
+	if err != nil {
+		return "", err
+	}
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			// the body that can not be re-acquired is read once and the buffer is reused for sending.
+			b, err := io.ReadAll(req.Body)
+			req.Body.Close()
+			if err != nil {
+				return "", err
+			}
+			req.ContentLength = int64(len(b))
+			req.Body = io.NopCloser(bytes.NewReader(b))
+			req.GetBody = func() (io.ReadCloser, error) {
+				return io.NopCloser(bytes.NewReader(b)), nil
+			}
+		}
+		body, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, body)
+		body.Close()
+		if err != nil {
+			return "", err
+		}
+		// the body read for the digest may share the offset with the request body, so the request body is re-acquired.
+		if body, err = req.GetBody(); err != nil {
+			return "", err
+		}
+		req.Body.Close()
+		req.Body = body
+	}
+	return fmt.Sprintf("%s=:%s:", algorithm, base64.StdEncoding.EncodeToString(h.Sum(nil))), nil
+}
+
+// newDigestHash returns the [hash.Hash] of the digest algorithm.
+func newDigestHash(algorithm string) (hash.Hash, error) {
+	switch algorithm {
+	case DigestAlgorithmSHA256:
+		return sha256.New(), nil
+	case DigestAlgorithmSHA512:
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("r2: unsupported digest algorithm '%s'", algorithm)
+}
+
+// signRequest sets 'Signature-Input' and 'Signature' headers to the request.
+func signRequest(req *http.Request, label string, signer Signer, components []string, created time.Time) error {
+	quoted := make([]string, 0, len(components))
+	for _, c := range components {
+		quoted = append(quoted, strconv.Quote(c))
+	}
+	params := fmt.Sprintf("(%s);created=%d;keyid=%s;alg=%s",
+		strings.Join(quoted, " "),
+		created.Unix(),
+		strconv.Quote(signer.KeyID()),
+		strconv.Quote(signer.Algorithm()))
+
+	base := bytes.Buffer{}
+	for _, c := range components {
+		v, err := componentValue(req, c)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&base, "%s: %s\n", strconv.Quote(c), v)
+	}
+	fmt.Fprintf(&base, "%s: %s", strconv.Quote("@signature-params"), params)
+
+	sig, err := signer.Sign(base.Bytes())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(headerKeySignatureInput, fmt.Sprintf("%s=%s", label, params))
+	req.Header.Set(headerKeySignature, fmt.Sprintf("%s=:%s:", label, base64.StdEncoding.EncodeToString(sig)))
+	return nil
+}
+
+// componentValue returns the value of the component in the signature base.
+func componentValue(req *http.Request, component string) (string, error) {
+	switch component {
+	case ComponentMethod:
+		return strings.ToUpper(req.Method), nil
+	case ComponentTargetURI:
+		return req.URL.String(), nil
+	case ComponentAuthority:
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+		return strings.ToLower(host), nil
+	case ComponentScheme:
+		return strings.ToLower(req.URL.Scheme), nil
+	case ComponentRequestTarget:
+		return req.URL.RequestURI(), nil
+	case ComponentPath:
+		if p := req.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case ComponentQuery:
+		return "?" + req.URL.RawQuery, nil
+	}
+	if strings.HasPrefix(component, "@") {
+		return "", fmt.Errorf("r2: unsupported signature component '%s'", component)
+	}
+	values := req.Header.Values(component)
+	if len(values) == 0 {
+		return "", fmt.Errorf("r2: signature component '%s' is not present in the request", component)
+	}
+	for i, v := range values {
+		values[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(values, ", "), nil
+}
+
+// verifyContentDigest verifies the response body against the 'Content-Digest' header.
+//
+// The response body is replaced with the one that can be read again.
+func verifyContentDigest(res *http.Response) error {
+	header := res.Header.Get(headerKeyContentDigest)
+	if header == "" || res.Body == nil || res.Body == http.NoBody {
+		return nil
+	}
+	b, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	return verifyDigest(header, func() (io.Reader, error) {
+		return bytes.NewReader(b), nil
+	})
+}
+
+// verifyDigest verifies the content read from open against the value of the digest header such as 'Content-Digest'.
+// open is called for each supported algorithm in the header.
+func verifyDigest(header string, open func() (io.Reader, error)) error {
+	for _, member := range strings.Split(header, ",") {
+		algorithm, value, ok := strings.Cut(strings.TrimSpace(member), "=")
+		if !ok {
+			continue
+		}
+		h, err := newDigestHash(strings.ToLower(algorithm))
+		if err != nil {
+			// unsupported algorithms are ignored.
+			continue
+		}
+		want, err := base64.StdEncoding.DecodeString(strings.Trim(value, ":"))
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrContentDigestMismatch, err)
+		}
+		r, err := open()
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		if !hmac.Equal(h.Sum(nil), want) {
+			return ErrContentDigestMismatch
+		}
+	}
+	return nil
+}
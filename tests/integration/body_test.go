@@ -0,0 +1,256 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// readSeeker hides the methods other than io.ReadSeeker.
+type readSeeker struct {
+	io.ReadSeeker
+}
+
+// reader hides the methods other than io.Reader.
+type reader struct {
+	io.Reader
+}
+
+func TestDoWithRewindableBody(t *testing.T) {
+	t.Parallel()
+	content := []byte(strings.Repeat("0123456789", 100))
+	path := filepath.Join(t.TempDir(), "body")
+	if err := os.WriteFile(path, content, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	type test struct {
+		body              func(t *testing.T) io.Reader
+		want              []byte
+		wantContentLength int64
+	}
+	tests := map[string]test{
+		"reader-at": {
+			body: func(t *testing.T) io.Reader {
+				f, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Cleanup(func() { f.Close() })
+				return f
+			},
+			want:              content,
+			wantContentLength: int64(len(content)),
+		},
+		"seeker": {
+			body: func(_ *testing.T) io.Reader {
+				rs := readSeeker{bytes.NewReader(content)}
+				rs.Seek(10, io.SeekStart)
+				return rs
+			},
+			want: content[10:],
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, tt.want) {
+					t.Errorf("Body got: %s, want: %s", b, tt.want)
+				}
+				// the length of the body wrapped by http.NewRequest is unknown, so it is sent as chunked.
+				if tt.wantContentLength != 0 && r.ContentLength != tt.wantContentLength {
+					t.Errorf("ContentLength got: %d, want: %d", r.ContentLength, tt.wantContentLength)
+				}
+				if reqTimes == 0 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			body := tt.body(t)
+			for _, err := range r2.Post(context.Background(), ts.URL, body, r2.WithInterval(time.Millisecond)) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if reqTimes != 2 {
+				t.Errorf("request times got: %d, want: 2", reqTimes)
+			}
+		})
+	}
+}
+
+func TestDoWithRewindableBodyAndContentDigest(t *testing.T) {
+	t.Parallel()
+	content := []byte(strings.Repeat("0123456789", 100))
+	digest := sha256.Sum256(content)
+	want := fmt.Sprintf("sha-256=:%s:", base64.StdEncoding.EncodeToString(digest[:]))
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("Body got: %d bytes, want: %d bytes", len(b), len(content))
+		}
+		if got := r.Header.Get("Content-Digest"); got != want {
+			t.Errorf("Content-Digest got: %s, want: %s", got, want)
+		}
+		if reqTimes == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	opts := []r2.Option{
+		r2.WithContentDigest(r2.DigestAlgorithmSHA256),
+		r2.WithInterval(time.Millisecond),
+	}
+	for _, err := range r2.Post(context.Background(), ts.URL, readSeeker{bytes.NewReader(content)}, opts...) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if reqTimes != 2 {
+		t.Errorf("request times got: %d, want: 2", reqTimes)
+	}
+}
+
+func TestDoWithRewindableBodyAndPeriod(t *testing.T) {
+	t.Parallel()
+	content := bytes.Repeat([]byte("0123456789"), 1<<16)
+	var (
+		mu       sync.Mutex
+		reqTimes int
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		n := reqTimes
+		reqTimes++
+		mu.Unlock()
+		if n == 0 {
+			// the first attempt times out while the body is being sent.
+			time.Sleep(100 * time.Millisecond)
+			io.Copy(io.Discard, r.Body)
+			return
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if !bytes.Equal(b, content) {
+			t.Errorf("Body got: %d bytes, want: %d bytes", len(b), len(content))
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	opts := []r2.Option{
+		r2.WithPeriod(20 * time.Millisecond),
+		r2.WithInterval(time.Millisecond),
+	}
+	var errs []error
+	for res, err := range r2.Post(context.Background(), ts.URL, readSeeker{bytes.NewReader(content)}, opts...) {
+		errs = append(errs, err)
+		if err == nil && res.StatusCode == http.StatusOK {
+			break
+		}
+	}
+	if len(errs) < 2 || errs[len(errs)-1] != nil {
+		t.Errorf("errors got: %v", errs)
+	}
+}
+
+func TestDoWithBodySpooling(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	content := []byte(strings.Repeat("0123456789", 100))
+
+	type test struct {
+		threshold int64
+		wantSpool bool
+	}
+	tests := map[string]test{
+		"above-threshold": {
+			threshold: 100,
+			wantSpool: true,
+		},
+		"below-threshold": {
+			threshold: 1000,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, content) {
+					t.Errorf("Body got: %s, want: %s", b, content)
+				}
+				spooled, err := filepath.Glob(filepath.Join(tmp, "r2-body-*"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := len(spooled) == 1; got != tt.wantSpool {
+					t.Errorf("spooled got: %v, want: %v", got, tt.wantSpool)
+				}
+				if reqTimes == 0 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := []r2.Option{
+				r2.WithBodySpooling(tt.threshold),
+				r2.WithInterval(time.Millisecond),
+			}
+			for _, err := range r2.Post(context.Background(), ts.URL, reader{bytes.NewReader(content)}, opts...) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if reqTimes != 2 {
+				t.Errorf("request times got: %d, want: 2", reqTimes)
+			}
+			if spooled, _ := filepath.Glob(filepath.Join(tmp, "r2-body-*")); len(spooled) != 0 {
+				t.Errorf("temporary files were not removed: %v", spooled)
+			}
+		})
+	}
+}
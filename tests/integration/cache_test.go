@@ -0,0 +1,357 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithCache(t *testing.T) {
+	t.Parallel()
+	type call struct {
+		method string
+		header http.Header
+	}
+	type want struct {
+		requests int32
+		// bodies is the body of the last response of each call. The empty string means no response.
+		bodies []string
+	}
+	tests := map[string]struct {
+		cacheControl string
+		vary         string
+		// fail returns true if the n-th request fails with 503(Service Unavailable).
+		fail  func(n int32) bool
+		calls []call
+		store func(t *testing.T) r2.CacheStore
+		want  want
+	}{
+		"fresh": {
+			cacheControl: "max-age=60",
+			calls:        []call{{}, {}},
+			want:         want{requests: 1, bodies: []string{"1", "1"}},
+		},
+		"fresh-on-disk": {
+			cacheControl: "max-age=60",
+			calls:        []call{{}, {}},
+			store: func(t *testing.T) r2.CacheStore {
+				return r2.NewDiskCacheStore(t.TempDir())
+			},
+			want: want{requests: 1, bodies: []string{"1", "1"}},
+		},
+		"revalidate": {
+			cacheControl: "no-cache",
+			calls:        []call{{}, {}},
+			// 304(Not Modified) is replaced with the stored response.
+			want: want{requests: 2, bodies: []string{"1", "1"}},
+		},
+		"request-no-cache": {
+			cacheControl: "max-age=60",
+			calls:        []call{{}, {header: http.Header{"Cache-Control": {"no-cache"}}}},
+			want:         want{requests: 2, bodies: []string{"1", "1"}},
+		},
+		"no-store": {
+			cacheControl: "no-store",
+			calls:        []call{{}, {}},
+			want:         want{requests: 2, bodies: []string{"1", "2"}},
+		},
+		"vary": {
+			cacheControl: "max-age=60",
+			vary:         "Accept-Language",
+			calls: []call{
+				{header: http.Header{"Accept-Language": {"en"}}},
+				{header: http.Header{"Accept-Language": {"ja"}}},
+				{header: http.Header{"Accept-Language": {"ja"}}},
+			},
+			want: want{requests: 2, bodies: []string{"1", "2", "2"}},
+		},
+		"stale-if-error": {
+			cacheControl: "max-age=0, stale-if-error=60",
+			fail:         func(n int32) bool { return n > 1 },
+			calls:        []call{{}, {}},
+			want:         want{requests: 3, bodies: []string{"1", "1"}},
+		},
+		"stale-if-error-with-must-revalidate": {
+			cacheControl: "max-age=0, stale-if-error=60, must-revalidate",
+			fail:         func(n int32) bool { return n > 1 },
+			calls:        []call{{}, {}},
+			want:         want{requests: 3, bodies: []string{"1", "error"}},
+		},
+		"invalidated-by-post": {
+			cacheControl: "max-age=60",
+			calls:        []call{{}, {method: http.MethodPost}, {}},
+			want:         want{requests: 3, bodies: []string{"1", "2", "3"}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var requests, version atomic.Int32
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				if tt.fail != nil && tt.fail(n) {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					io.WriteString(w, "error")
+					return
+				}
+				w.Header().Set("Cache-Control", tt.cacheControl)
+				if tt.vary != "" {
+					w.Header().Set("Vary", tt.vary)
+				}
+				current := strconv.Itoa(int(version.Load()))
+				if r.Method == http.MethodGet && r.Header.Get("If-None-Match") == `"`+current+`"` {
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				// the representation is changed on every request except the conditional one.
+				current = strconv.Itoa(int(version.Add(1)))
+				w.Header().Set("ETag", `"`+current+`"`)
+				io.WriteString(w, current)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			var store r2.CacheStore = r2.NewMemoryCacheStore(10)
+			if tt.store != nil {
+				store = tt.store(t)
+			}
+			for i, c := range tt.calls {
+				method := c.method
+				if method == "" {
+					method = http.MethodGet
+				}
+				opts := []r2.Option{
+					r2.WithCache(store),
+					r2.WithInterval(time.Millisecond),
+					r2.WithMaxRequestAttempts(2),
+					r2.WithHeader(c.header),
+					r2.WithAutoCloseResponseBody(false),
+				}
+				var body string
+				for res, err := range r2.Do(context.Background(), ts.URL, method, nil, opts...) {
+					if err != nil || res == nil {
+						continue
+					}
+					b, err := io.ReadAll(res.Body)
+					res.Body.Close()
+					if err != nil {
+						t.Fatal(err)
+					}
+					body = string(b)
+				}
+				if body != tt.want.bodies[i] {
+					t.Errorf("body of call %d got: %q, want: %q", i, body, tt.want.bodies[i])
+				}
+			}
+			if got := requests.Load(); got != tt.want.requests {
+				t.Errorf("requests got: %d, want: %d", got, tt.want.requests)
+			}
+		})
+	}
+}
+
+func TestWithCacheAndGetJSON(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", r2.ContentTypeApplicationJSON)
+		io.WriteString(w, `{"name":"r2","count":2}`)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	store := r2.NewMemoryCacheStore(10)
+	for i := range 2 {
+		var got decodedItem
+		for result, err := range r2.GetJSON[decodedItem](context.Background(), ts.URL, r2.WithCache(store)) {
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+			got = result.Value
+		}
+		// the fresh stored response is decoded in the same way as the response of the request.
+		if want := (decodedItem{Name: "r2", Count: 2}); got != want {
+			t.Errorf("Value of call %d got: %v, want: %v", i, got, want)
+		}
+	}
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests got: %d, want: 1", got)
+	}
+}
+
+func TestWithCacheAndTerminateIf(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("ETag", `"1"`)
+		if r.Header.Get("If-None-Match") == `"1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		io.WriteString(w, "1")
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	store := r2.NewMemoryCacheStore(10)
+	opts := []r2.Option{
+		r2.WithCache(store),
+		r2.WithInterval(time.Millisecond),
+		r2.WithMaxRequestAttempts(2),
+		r2.WithTerminateIf(func(_ *http.Response, _ error) bool { return false }),
+	}
+	// stores the response.
+	for _, err := range r2.Get(context.Background(), ts.URL, opts...) {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests.Store(0)
+
+	responses := 0
+	for res, err := range r2.Get(context.Background(), ts.URL, opts...) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if res == nil || res.StatusCode != http.StatusOK {
+			t.Errorf("response got: %v", res)
+		}
+		responses++
+	}
+	// the fresh stored response is not accepted, so that it is revalidated.
+	// the stored response counts toward the maximum number of requests.
+	if got := requests.Load(); got != 1 {
+		t.Errorf("requests got: %d, want: 1", got)
+	}
+	if responses != 2 {
+		t.Errorf("responses got: %d, want: 2", responses)
+	}
+}
+
+func TestWithCacheStaleIfError(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		status  int
+		options []r2.Option
+		want    []int
+	}{
+		"max-request-attempts": {
+			status: http.StatusServiceUnavailable,
+			want:   []int{http.StatusServiceUnavailable, http.StatusOK},
+		},
+		"client-error": {
+			status: http.StatusNotFound,
+			want:   []int{http.StatusOK},
+		},
+		"fail": {
+			status: http.StatusServiceUnavailable,
+			options: []r2.Option{
+				r2.WithClassifier(func(_ *http.Response, _ error, _ r2.Attempt) r2.Decision {
+					return r2.Fail(errors.New("failed"))
+				}),
+			},
+			want: []int{http.StatusOK},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var requests atomic.Int32
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if requests.Add(1) > 1 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+				w.Header().Set("ETag", `"1"`)
+				io.WriteString(w, "1")
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			store := r2.NewMemoryCacheStore(10)
+			opts := []r2.Option{
+				r2.WithCache(store),
+				r2.WithInterval(time.Millisecond),
+				r2.WithMaxRequestAttempts(2),
+			}
+			// stores the response.
+			for _, err := range r2.Get(context.Background(), ts.URL, opts...) {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var got []int
+			for res, err := range r2.Get(context.Background(), ts.URL, append(opts, tt.options...)...) {
+				if res == nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if res.StatusCode == http.StatusOK && err != nil {
+					t.Errorf("unexpected error with the stale response: %v", err)
+				}
+				got = append(got, res.StatusCode)
+			}
+			// the stale response is served in place of the last failure.
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("status codes got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCacheStaleIfErrorWithContextDeadline(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "error")
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=0, stale-if-error=60")
+		w.Header().Set("ETag", `"1"`)
+		io.WriteString(w, "1")
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	store := r2.NewMemoryCacheStore(10)
+	opts := []r2.Option{
+		r2.WithCache(store),
+		r2.WithInterval(10 * time.Millisecond),
+		r2.WithAutoCloseResponseBody(false),
+	}
+	for i := range 2 {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		var body string
+		// the maximum number of requests is not limited, so that the iterator is terminated by the context.
+		for res, err := range r2.Get(ctx, ts.URL, opts...) {
+			if err != nil || res == nil {
+				continue
+			}
+			b, err := io.ReadAll(res.Body)
+			res.Body.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = string(b)
+		}
+		cancel()
+		if body != "1" {
+			t.Errorf("body of call %d got: %q, want: %q", i, body, "1")
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/miyamo2/r2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownloadChunks(t *testing.T) {
+	t.Parallel()
+	content := bytes.Repeat([]byte("abcdefghij"), 1000)
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type want struct {
+		err        error
+		concurrent int
+	}
+	tests := map[string]struct {
+		// handle returns true if it handled the request instead of the default.
+		handle func(w http.ResponseWriter, r *http.Request, reqTimes int) bool
+		opts   []r2.Option
+		want   want
+	}{
+		"success": {
+			handle: func(w http.ResponseWriter, r *http.Request, reqTimes int) bool {
+				switch r.Header.Get("Range") {
+				case "bytes=2500-4999":
+					// the chunk fails once.
+					if reqTimes == 0 {
+						w.WriteHeader(http.StatusInternalServerError)
+						return true
+					}
+				case "bytes=5000-7499":
+					// the connection drops in the middle of the chunk, and only the rest is requested.
+					w.Header().Set("Content-Range", "bytes 5000-7499/10000")
+					w.Header().Set("Content-Length", "2500")
+					w.WriteHeader(http.StatusPartialContent)
+					w.Write(content[5000:6000])
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				return false
+			},
+			opts: []r2.Option{r2.WithChunks(4), r2.WithConcurrency(2)},
+			want: want{concurrent: 2},
+		},
+		"resource-changed": {
+			handle: func(w http.ResponseWriter, r *http.Request, _ int) bool {
+				if r.Method == http.MethodGet {
+					// 'If-Range' is not satisfied, and the whole body is sent.
+					w.Header().Set("ETag", `"v2"`)
+					w.WriteHeader(http.StatusOK)
+					w.Write(content)
+					return true
+				}
+				return false
+			},
+			want: want{err: r2.ErrResourceChanged},
+		},
+		"range-not-supported": {
+			handle: func(w http.ResponseWriter, r *http.Request, _ int) bool {
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.WriteHeader(http.StatusOK)
+				if r.Method == http.MethodGet {
+					w.Write(content)
+				}
+				return true
+			},
+			want: want{err: r2.ErrRangeNotSupported},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				mu                    sync.Mutex
+				reqTimes              = map[string]int{}
+				inFlight, maxInFlight int
+			)
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				key := r.Method + r.Header.Get("Range")
+				n := reqTimes[key]
+				reqTimes[key]++
+				inFlight++
+				maxInFlight = max(maxInFlight, inFlight)
+				mu.Unlock()
+				defer func() {
+					mu.Lock()
+					inFlight--
+					mu.Unlock()
+				}()
+				// keep the chunks in flight for a while to observe the concurrency.
+				time.Sleep(10 * time.Millisecond)
+				if tt.handle(w, r, n) {
+					return
+				}
+				w.Header().Set("ETag", `"v1"`)
+				http.ServeContent(w, r, "", modTime, bytes.NewReader(content))
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			f, err := os.Create(filepath.Join(t.TempDir(), "file.bin"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+
+			var lastDone, lastTotal int64
+			opts := append([]r2.Option{
+				r2.WithInterval(time.Millisecond),
+				r2.WithProgress(func(done, total int64) {
+					if done < lastDone {
+						t.Errorf("progress went back from %d to %d", lastDone, done)
+					}
+					lastDone, lastTotal = done, total
+				}),
+			}, tt.opts...)
+			n, err := r2.DownloadChunks(context.Background(), ts.URL, f, opts...)
+			if !errors.Is(err, tt.want.err) {
+				t.Fatalf("error got: %v, want: %v", err, tt.want.err)
+			}
+			if tt.want.err != nil {
+				return
+			}
+			if n != int64(len(content)) {
+				t.Errorf("written got: %d, want: %d", n, len(content))
+			}
+			if lastDone != int64(len(content)) || lastTotal != int64(len(content)) {
+				t.Errorf("progress got: %d/%d, want: %d/%d", lastDone, lastTotal, len(content), len(content))
+			}
+			got, err := os.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("content does not match")
+			}
+			if maxInFlight > tt.want.concurrent {
+				t.Errorf("concurrency got: %d, want: %d or less", maxInFlight, tt.want.concurrent)
+			}
+			if got := reqTimes[http.MethodGet+"bytes=6000-7499"]; got != 1 {
+				t.Errorf("resumed chunk request times got: %d, want: 1", got)
+			}
+		})
+	}
+}
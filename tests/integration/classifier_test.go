@@ -0,0 +1,143 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithClassifier(t *testing.T) {
+	t.Parallel()
+	errFailed := errors.New("failed")
+	type want struct {
+		err error
+	}
+	tests := map[string]struct {
+		statuses   []int
+		classifier r2.Classifier
+		wants      []want
+	}{
+		"retry-successful-response": {
+			statuses: []int{http.StatusOK, http.StatusOK},
+			classifier: func(res *http.Response, _ error, _ r2.Attempt) r2.Decision {
+				b, _ := io.ReadAll(res.Body)
+				if strings.Contains(string(b), `"status":"pending"`) {
+					return r2.Retry()
+				}
+				return r2.Default()
+			},
+			wants: []want{{}, {}},
+		},
+		"retry-client-error": {
+			statuses: []int{http.StatusNotFound, http.StatusOK},
+			classifier: func(res *http.Response, _ error, _ r2.Attempt) r2.Decision {
+				if res.StatusCode == http.StatusNotFound {
+					return r2.Retry()
+				}
+				return r2.Default()
+			},
+			wants: []want{{}, {}},
+		},
+		"stop-server-error": {
+			statuses: []int{http.StatusServiceUnavailable, http.StatusOK},
+			classifier: func(_ *http.Response, _ error, _ r2.Attempt) r2.Decision {
+				return r2.Stop()
+			},
+			wants: []want{{}},
+		},
+		"fail": {
+			statuses: []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK},
+			classifier: func(_ *http.Response, _ error, attempt r2.Attempt) r2.Decision {
+				if attempt.Number == 1 {
+					return r2.Fail(errFailed)
+				}
+				return r2.Default()
+			},
+			wants: []want{{}, {err: errFailed}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				w.WriteHeader(tt.statuses[reqTimes])
+				if reqTimes == 0 {
+					fmt.Fprint(w, `{"status":"pending"}`)
+					return
+				}
+				fmt.Fprint(w, `{"status":"done"}`)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := []r2.Option{
+				r2.WithClassifier(tt.classifier),
+				r2.WithInterval(time.Millisecond),
+				r2.WithMaxRequestAttempts(len(tt.statuses)),
+			}
+			i := 0
+			for res, err := range r2.Get(context.Background(), ts.URL, opts...) {
+				if i >= len(tt.wants) {
+					t.Fatalf("request times got: %d or more, want: %d", i+1, len(tt.wants))
+				}
+				if !errors.Is(err, tt.wants[i].err) {
+					t.Errorf("error got: %v, want: %v", err, tt.wants[i].err)
+				}
+				// the body is left unread for the consumer.
+				if b, _ := io.ReadAll(res.Body); len(b) == 0 {
+					t.Errorf("body got: empty")
+				}
+				i++
+			}
+			if i != len(tt.wants) {
+				t.Errorf("request times got: %d, want: %d", i, len(tt.wants))
+			}
+		})
+	}
+}
+
+func TestWithClassifierRetryAfter(t *testing.T) {
+	t.Parallel()
+	var requestedAt []time.Time
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedAt = append(requestedAt, time.Now())
+		if len(requestedAt) == 1 {
+			// Retry-After is ignored in favor of the decision.
+			w.Header().Set("Retry-After", "1h")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	classifier := func(res *http.Response, _ error, _ r2.Attempt) r2.Decision {
+		if res.StatusCode == http.StatusTooManyRequests {
+			return r2.RetryAfter(100 * time.Millisecond)
+		}
+		return r2.Default()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, err := range r2.Get(ctx, ts.URL, r2.WithClassifier(classifier)) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if len(requestedAt) != 2 {
+		t.Fatalf("request times got: %d, want: 2", len(requestedAt))
+	}
+	if wait := requestedAt[1].Sub(requestedAt[0]); wait < 100*time.Millisecond || wait > 5*time.Second {
+		t.Errorf("wait got: %s, want: about 100ms", wait)
+	}
+}
@@ -0,0 +1,205 @@
+package integration
+
+import (
+	"context"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithCoalescing(t *testing.T) {
+	t.Parallel()
+	type want struct {
+		requests int32
+		events   []string
+	}
+	tests := map[string]struct {
+		subscribers int
+		// header returns the header of the i-th subscriber.
+		header func(i int) http.Header
+		// token returns the bearer token provided to the i-th subscriber. nil means no credential provider.
+		token func(i int) string
+		// breakAfter is the number of the events after which the subscriber breaks. 0 means never.
+		breakAfter int
+		interval   time.Duration
+		want       want
+	}{
+		"coalesced": {
+			subscribers: 20,
+			header: func(_ int) http.Header {
+				return http.Header{"Accept": {"application/json"}}
+			},
+			interval: time.Millisecond,
+			want:     want{requests: 2, events: []string{"503:", "200:ok"}},
+		},
+		"distinguished-by-header": {
+			subscribers: 20,
+			header: func(i int) http.Header {
+				return http.Header{"Accept-Language": {strconv.Itoa(i % 2)}}
+			},
+			interval: time.Millisecond,
+			want:     want{requests: 4, events: []string{"503:", "200:ok"}},
+		},
+		"not-coalesced-with-credential-provider": {
+			subscribers: 4,
+			header: func(_ int) http.Header {
+				return http.Header{}
+			},
+			token: func(i int) string {
+				return strconv.Itoa(i)
+			},
+			interval: time.Millisecond,
+			want:     want{requests: 8, events: []string{"503:", "200:ok"}},
+		},
+		"canceled-when-every-subscriber-leaves": {
+			subscribers: 1,
+			header: func(_ int) http.Header {
+				return http.Header{}
+			},
+			breakAfter: 1,
+			interval:   500 * time.Millisecond,
+			want:       want{requests: 1, events: []string{"503:"}},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				requests atomic.Int32
+				mu       sync.Mutex
+				attempts = map[string]int{}
+			)
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				// wait for every subscriber to join.
+				time.Sleep(100 * time.Millisecond)
+				mu.Lock()
+				key := r.Header.Get("Accept-Language") + " " + r.Header.Get("Authorization")
+				n := attempts[key]
+				attempts[key]++
+				mu.Unlock()
+				if n == 0 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				io.WriteString(w, "ok")
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			var (
+				wg    sync.WaitGroup
+				start = make(chan struct{})
+			)
+			results := make([][]string, tt.subscribers)
+			for i := range tt.subscribers {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					<-start
+					opts := []r2.Option{
+						r2.WithCoalescing("Accept-Language"),
+						r2.WithHeader(tt.header(i)),
+						r2.WithInterval(tt.interval),
+					}
+					if tt.token != nil {
+						token := tt.token(i)
+						opts = append(opts, r2.WithCredentialProvider(r2.CredentialProviderFunc(func(_ *http.Request) (r2.Credential, error) {
+							return r2.BearerToken(token), nil
+						})))
+					}
+					for res, err := range r2.Get(context.Background(), ts.URL, opts...) {
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						b, err := io.ReadAll(res.Body)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						results[i] = append(results[i], strconv.Itoa(res.StatusCode)+":"+string(b))
+						if len(results[i]) == tt.breakAfter {
+							break
+						}
+					}
+				}()
+			}
+			close(start)
+			wg.Wait()
+			// wait for the canceled flight to stop.
+			time.Sleep(tt.interval + 100*time.Millisecond)
+
+			if got := requests.Load(); got != tt.want.requests {
+				t.Errorf("requests got: %d, want: %d", got, tt.want.requests)
+			}
+			for i, events := range results {
+				if !slices.Equal(events, tt.want.events) {
+					t.Errorf("events of subscriber %d got: %q, want: %q", i, events, tt.want.events)
+				}
+			}
+		})
+	}
+}
+
+func TestWithCoalescingWithAuthorization(t *testing.T) {
+	t.Parallel()
+	var requests atomic.Int32
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		// wait for every subscriber to join.
+		time.Sleep(100 * time.Millisecond)
+		io.WriteString(w, "secret-for:"+r.Header.Get("Authorization"))
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var (
+		wg    sync.WaitGroup
+		start = make(chan struct{})
+	)
+	tokens := []string{"Bearer alice", "Bearer bob", "Bearer alice", "Bearer bob"}
+	results := make([]string, len(tokens))
+	for i, token := range tokens {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			opts := []r2.Option{
+				// the 'Authorization' header is not listed, but it distinguishes the requests.
+				r2.WithCoalescing(),
+				r2.WithHeader(http.Header{"Authorization": {token}}),
+			}
+			for res, err := range r2.Get(context.Background(), ts.URL, opts...) {
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				b, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				results[i] = string(b)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	for i, token := range tokens {
+		if want := "secret-for:" + token; results[i] != want {
+			t.Errorf("body of subscriber %d got: %q, want: %q", i, results[i], want)
+		}
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("requests got: %d, want: 2", got)
+	}
+}
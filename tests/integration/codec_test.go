@@ -0,0 +1,191 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/miyamo2/r2"
+	_ "github.com/miyamo2/r2/codec/msgpack"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type codecItem struct {
+	Name  string `json:"name" xml:"name" msgpack:"name"`
+	Count int    `json:"count" xml:"count" msgpack:"count"`
+}
+
+func TestPostValue(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		contentType string
+		value       any
+		decode      func(b []byte) (any, error)
+		want        any
+	}{
+		"default": {
+			value: codecItem{Name: "r2", Count: 2},
+			decode: func(b []byte) (any, error) {
+				var v codecItem
+				err := json.Unmarshal(b, &v)
+				return v, err
+			},
+			want: codecItem{Name: "r2", Count: 2},
+		},
+		"xml": {
+			contentType: r2.ContentTypeApplicationXML,
+			value:       codecItem{Name: "r2", Count: 2},
+			decode: func(b []byte) (any, error) {
+				return string(b), nil
+			},
+			want: `<codecItem><name>r2</name><count>2</count></codecItem>`,
+		},
+		"form": {
+			contentType: r2.ContentTypeApplicationFormURLEncoded,
+			value:       map[string]string{"name": "r2"},
+			decode: func(b []byte) (any, error) {
+				return string(b), nil
+			},
+			want: `name=r2`,
+		},
+		"msgpack": {
+			contentType: r2.ContentTypeApplicationMsgPack,
+			value:       codecItem{Name: "r2", Count: 2},
+			decode: func(b []byte) (any, error) {
+				var v codecItem
+				err := msgpack.Unmarshal(b, &v)
+				return v, err
+			},
+			want: codecItem{Name: "r2", Count: 2},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			wantContentType := tt.contentType
+			if wantContentType == "" {
+				wantContentType = r2.ContentTypeApplicationJSON
+			}
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				if got := r.Header.Get("Content-Type"); got != wantContentType {
+					t.Errorf("Content-Type got: %s, want: %s", got, wantContentType)
+				}
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if r.ContentLength != int64(len(b)) {
+					t.Errorf("Content-Length got: %d, want: %d", r.ContentLength, len(b))
+				}
+				got, err := tt.decode(b)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got != tt.want {
+					t.Errorf("body got: %v, want: %v", got, tt.want)
+				}
+				if reqTimes == 0 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := []r2.Option{
+				r2.WithInterval(time.Millisecond),
+			}
+			if tt.contentType != "" {
+				opts = append(opts, r2.WithContentType(tt.contentType))
+			}
+			for _, err := range r2.PostValue(context.Background(), ts.URL, tt.value, opts...) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			if reqTimes != 2 {
+				t.Errorf("request times got: %d, want: 2", reqTimes)
+			}
+		})
+	}
+}
+
+func TestPostValueWithUnsupportedContentType(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	i := 0
+	for res, err := range r2.PostValue(context.Background(), ts.URL, "r2", r2.WithContentType(r2.ContentTypeTextCSV)) {
+		if !errors.Is(err, r2.ErrUnsupportedContentType) {
+			t.Errorf("error got: %v, want: %v", err, r2.ErrUnsupportedContentType)
+		}
+		if res != nil {
+			t.Errorf("response got: %v, want: nil", res)
+		}
+		i++
+	}
+	if i != 1 {
+		t.Errorf("yield times got: %d, want: 1", i)
+	}
+}
+
+type upperCodec struct{}
+
+func (upperCodec) Marshal(v any) ([]byte, error) {
+	return []byte(strings.ToUpper(v.(string))), nil
+}
+
+func (upperCodec) Unmarshal(data []byte, v any) error {
+	*v.(*string) = strings.ToLower(string(data))
+	return nil
+}
+
+func TestRegisterCodec(t *testing.T) {
+	t.Parallel()
+	const contentType = "application/x-r2-upper"
+	r2.RegisterCodec(contentType, upperCodec{})
+
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), "R2"; got != want {
+			t.Errorf("body got: %s, want: %s", got, want)
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(b)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	for res, err := range r2.PostValue(context.Background(), ts.URL, "r2", r2.WithContentType(contentType)) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if res.StatusCode != http.StatusOK {
+			t.Errorf("status code got: %d, want: %d", res.StatusCode, http.StatusOK)
+		}
+	}
+	for result, err := range r2.DoAs[string](context.Background(), ts.URL, http.MethodPost, strings.NewReader("R2")) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if got, want := result.Value, "r2"; got != want {
+			t.Errorf("Value got: %s, want: %s", got, want)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWithCredentialProviderEnv(t *testing.T) {
+	t.Setenv("R2_TEST_TOKEN", "token-0")
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		if got, want := r.Header.Get("Authorization"), fmt.Sprintf("Bearer token-%d", reqTimes); got != want {
+			t.Errorf("Authorization got: %s, want: %s", got, want)
+		}
+		if reqTimes == 0 {
+			os.Setenv("R2_TEST_TOKEN", "token-1")
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	opts := []r2.Option{
+		r2.WithCredentialProvider(r2.NewEnvCredentialProvider("R2_TEST_TOKEN", r2.BearerToken)),
+		r2.WithInterval(time.Millisecond),
+	}
+	for _, err := range r2.Get(context.Background(), ts.URL, opts...) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if reqTimes != 2 {
+		t.Errorf("request times got: %d, want: 2", reqTimes)
+	}
+}
+
+func TestWithCredentialProviderFile(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "api-key")
+	if err := os.WriteFile(path, []byte("key-0\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	header := http.Header{"X-Something": []string{"value"}}
+
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		if got, want := r.Header.Get("X-Api-Key"), fmt.Sprintf("key-%d", reqTimes); got != want {
+			t.Errorf("X-Api-Key got: %s, want: %s", got, want)
+		}
+		if reqTimes == 0 {
+			if err := os.WriteFile(path, []byte("key-1\n"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			// make sure that the modification time changes.
+			if err := os.Chtimes(path, time.Now(), time.Now().Add(time.Minute)); err != nil {
+				t.Fatal(err)
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	opts := []r2.Option{
+		r2.WithHeader(header),
+		r2.WithCredentialProvider(r2.NewFileCredentialProvider(path, func(secret string) r2.Credential {
+			return r2.HeaderValue("X-Api-Key", secret)
+		})),
+		r2.WithInterval(time.Millisecond),
+	}
+	for _, err := range r2.Get(context.Background(), ts.URL, opts...) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if reqTimes != 2 {
+		t.Errorf("request times got: %d, want: 2", reqTimes)
+	}
+	if _, ok := header["X-Api-Key"]; ok {
+		t.Errorf("the header specified in WithHeader was modified: %v", header)
+	}
+}
+
+func TestWithCredentialProviderNetrc(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "user" || password != "pass" {
+			t.Errorf("BasicAuth got: %s:%s, want: user:pass", username, password)
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	path := filepath.Join(t.TempDir(), ".netrc")
+	netrc := `machine example.com login other password other
+macdef init
+cd /pub
+
+machine 127.0.0.1
+	login user
+	password pass
+default login anonymous password anonymous
+`
+	if err := os.WriteFile(path, []byte(netrc), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	i := 0
+	for _, err := range r2.Get(context.Background(), ts.URL, r2.WithCredentialProvider(r2.NewNetrcCredentialProvider(path))) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		i++
+	}
+	if i != 1 {
+		t.Errorf("request times got: %d, want: 1", i)
+	}
+}
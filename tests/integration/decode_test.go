@@ -0,0 +1,189 @@
+package integration
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type decodedItem struct {
+	XMLName xml.Name `json:"-" xml:"item"`
+	Name    string   `json:"name" xml:"name"`
+	Count   int      `json:"count" xml:"count"`
+}
+
+func TestGetJSON(t *testing.T) {
+	t.Parallel()
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		if reqTimes == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", r2.ContentTypeApplicationJSON)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"name":"r2","count":2}`))
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var results []r2.Result[decodedItem]
+	for result, err := range r2.GetJSON[decodedItem](context.Background(), ts.URL, r2.WithInterval(time.Millisecond)) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		results = append(results, result)
+	}
+	if len(results) != 2 {
+		t.Fatalf("request times got: %d, want: 2", len(results))
+	}
+	if got := results[0].Value; got != (decodedItem{}) {
+		t.Errorf("Value of 5xx response got: %v, want: zero value", got)
+	}
+	if got, want := results[1].Value, (decodedItem{Name: "r2", Count: 2}); got != want {
+		t.Errorf("Value got: %v, want: %v", got, want)
+	}
+	b, err := io.ReadAll(results[1].Response.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(b), `{"name":"r2","count":2}`; got != want {
+		t.Errorf("raw body got: %s, want: %s", got, want)
+	}
+}
+
+func TestGetXML(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r2.ContentTypeApplicationXML)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`<item><name>r2</name><count>2</count></item>`))
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	i := 0
+	for result, err := range r2.GetXML[decodedItem](context.Background(), ts.URL) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if got := result.Value; got.Name != "r2" || got.Count != 2 {
+			t.Errorf("Value got: %v, want: {r2 2}", got)
+		}
+		i++
+	}
+	if i != 1 {
+		t.Errorf("request times got: %d, want: 1", i)
+	}
+}
+
+func TestDoAs(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		contentType string
+		body        string
+		wantErr     error
+	}{
+		"json": {
+			contentType: "application/problem+json; charset=utf-8",
+			body:        `{"name":"r2","count":2}`,
+		},
+		"xml": {
+			contentType: "text/xml",
+			body:        `<item><name>r2</name><count>2</count></item>`,
+		},
+		"unsupported": {
+			contentType: r2.ContentTypeTextPlain,
+			body:        `r2`,
+			wantErr:     r2.ErrUnsupportedContentType,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(http.StatusOK)
+				w.Write([]byte(tt.body))
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			for result, err := range r2.DoAs[decodedItem](context.Background(), ts.URL, http.MethodPost, nil) {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("error got: %v, want: %v", err, tt.wantErr)
+				}
+				if tt.wantErr != nil {
+					continue
+				}
+				if got := result.Value; got.Name != "r2" || got.Count != 2 {
+					t.Errorf("Value got: %v, want: {r2 2}", got)
+				}
+			}
+		})
+	}
+}
+
+func TestGetJSONWithDecodeError(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		retryOnDecodeError bool
+		wantReqTimes       int
+	}{
+		"not-retried": {
+			wantReqTimes: 1,
+		},
+		"retried": {
+			retryOnDecodeError: true,
+			wantReqTimes:       2,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				w.Header().Set("Content-Type", r2.ContentTypeApplicationJSON)
+				w.WriteHeader(http.StatusOK)
+				if reqTimes == 0 {
+					w.Write([]byte(`{"name":`))
+					return
+				}
+				w.Write([]byte(`{"name":"r2","count":2}`))
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := []r2.Option{
+				r2.WithRetryOnDecodeError(tt.retryOnDecodeError),
+				r2.WithInterval(time.Millisecond),
+			}
+			i := 0
+			for result, err := range r2.GetJSON[decodedItem](context.Background(), ts.URL, opts...) {
+				if i == 0 {
+					var decodeErr *r2.DecodeError
+					if !errors.As(err, &decodeErr) {
+						t.Errorf("error got: %v, want: *r2.DecodeError", err)
+					}
+					if result.Response == nil || result.Response.StatusCode != http.StatusOK {
+						t.Errorf("Response got: %v, want: 200 OK", result.Response)
+					}
+				} else if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				i++
+			}
+			if i != tt.wantReqTimes {
+				t.Errorf("request times got: %d, want: %d", i, tt.wantReqTimes)
+			}
+		})
+	}
+}
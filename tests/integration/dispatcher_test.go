@@ -0,0 +1,217 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		// every request fails once.
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, strings.TrimPrefix(r.URL.Path, "/"))
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	d := r2.NewDispatcher(2, 10, r2.WithInterval(time.Millisecond))
+	futures := make([]*r2.Future, 10)
+	for i := range futures {
+		future, err := d.Submit(context.Background(), r2.Request{URL: ts.URL + "/" + strconv.Itoa(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures[i] = future
+	}
+	// the queued requests are drained.
+	if err := d.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for i, future := range futures {
+		select {
+		case <-future.Done():
+		default:
+			t.Fatalf("future %d is not done after shutdown", i)
+		}
+		res, err := future.Wait(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != strconv.Itoa(i) {
+			t.Errorf("body of future %d got: %s", i, b)
+		}
+		if outcome, ok := future.Outcome(); !ok || outcome.Index != i {
+			t.Errorf("outcome of future %d got: %d, %t", i, outcome.Index, ok)
+		}
+	}
+	if _, err := d.Submit(context.Background(), r2.Request{URL: ts.URL}); !errors.Is(err, r2.ErrDispatcherClosed) {
+		t.Errorf("error after shutdown got: %v, want: %v", err, r2.ErrDispatcherClosed)
+	}
+}
+
+func TestDispatcherWithBackpressure(t *testing.T) {
+	t.Parallel()
+	type want struct {
+		submitErr error
+		futureErr error
+	}
+	tests := map[string]struct {
+		backpressure r2.Backpressure
+		want         want
+	}{
+		"block": {
+			backpressure: r2.BackpressureBlock,
+			want:         want{submitErr: context.DeadlineExceeded},
+		},
+		"drop": {
+			backpressure: r2.BackpressureDrop,
+			want:         want{futureErr: r2.ErrQueueFull},
+		},
+		"error": {
+			backpressure: r2.BackpressureError,
+			want:         want{submitErr: r2.ErrQueueFull},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			received := make(chan struct{}, 3)
+			release := make(chan struct{})
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				received <- struct{}{}
+				<-release
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			d := r2.NewDispatcher(1, 1, r2.WithBackpressure(tt.backpressure))
+			defer d.Shutdown(context.Background())
+			// the handlers are released before the shutdown drains the queue.
+			defer close(release)
+			// the first request is in flight, and the second one is queued.
+			if _, err := d.Submit(context.Background(), r2.Request{URL: ts.URL}); err != nil {
+				t.Fatal(err)
+			}
+			<-received
+			if _, err := d.Submit(context.Background(), r2.Request{URL: ts.URL}); err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			future, err := d.Submit(ctx, r2.Request{URL: ts.URL})
+			if !errors.Is(err, tt.want.submitErr) {
+				t.Fatalf("submit error got: %v, want: %v", err, tt.want.submitErr)
+			}
+			if err != nil {
+				return
+			}
+			outcome, ok := future.Outcome()
+			if !ok || !errors.Is(outcome.Err, tt.want.futureErr) {
+				t.Errorf("outcome got: %v, %t, want: %v", outcome.Err, ok, tt.want.futureErr)
+			}
+		})
+	}
+}
+
+func TestDispatcherShutdownWithTimeout(t *testing.T) {
+	t.Parallel()
+	release := make(chan struct{})
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+	defer close(release)
+
+	d := r2.NewDispatcher(1, 10, r2.WithMaxRequestAttempts(1))
+	futures := make([]*r2.Future, 3)
+	for i := range futures {
+		future, err := d.Submit(context.Background(), r2.Request{URL: ts.URL})
+		if err != nil {
+			t.Fatal(err)
+		}
+		futures[i] = future
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown error got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+	// every future is completed with the error of the canceled request.
+	for i, future := range futures {
+		outcome, ok := future.Outcome()
+		if !ok || outcome.Err == nil {
+			t.Errorf("outcome of future %d got: %v, %t", i, outcome.Err, ok)
+		}
+	}
+}
+
+func TestDispatcherShutdownWithBlockedSubmission(t *testing.T) {
+	t.Parallel()
+	received := make(chan struct{}, 2)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+		<-r.Context().Done()
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	d := r2.NewDispatcher(1, 1, r2.WithMaxRequestAttempts(1))
+	// the first request is in flight, and the second one is queued.
+	if _, err := d.Submit(context.Background(), r2.Request{URL: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+	<-received
+	if _, err := d.Submit(context.Background(), r2.Request{URL: ts.URL}); err != nil {
+		t.Fatal(err)
+	}
+	submitErr := make(chan error, 1)
+	go func() {
+		_, err := d.Submit(context.Background(), r2.Request{URL: ts.URL})
+		submitErr <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := d.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("shutdown error got: %v, want: %v", err, context.DeadlineExceeded)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown took: %v, want: less than %v", elapsed, time.Second)
+	}
+	if err := <-submitErr; !errors.Is(err, r2.ErrDispatcherClosed) {
+		t.Errorf("blocked submit error got: %v, want: %v", err, r2.ErrDispatcherClosed)
+	}
+}
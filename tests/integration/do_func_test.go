@@ -0,0 +1,103 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDoFunc(t *testing.T) {
+	t.Parallel()
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), fmt.Sprintf("nonce-%d", reqTimes); got != want {
+			t.Errorf("Body got: %s, want: %s", got, want)
+		}
+		if got, want := r.URL.Query().Get("attempt"), fmt.Sprint(reqTimes); got != want {
+			t.Errorf("attempt got: %s, want: %s", got, want)
+		}
+		if got, want := r.Header.Get("Content-Type"), r2.ContentTypeTextPlain; got != want {
+			t.Errorf("Content-Type got: %s, want: %s", got, want)
+		}
+		if got, want := r.Header.Get("X-Something"), "value"; got != want {
+			t.Errorf("X-Something got: %s, want: %s", got, want)
+		}
+		if reqTimes < 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	newRequest := func(attempt int) (*http.Request, error) {
+		// the body is streamed from a reader that can not be rewound.
+		body := io.MultiReader(bytes.NewBufferString(fmt.Sprintf("nonce-%d", attempt)))
+		return http.NewRequest(http.MethodPost, fmt.Sprintf("%s?attempt=%d", ts.URL, attempt), body)
+	}
+	opts := []r2.Option{
+		r2.WithContentType(r2.ContentTypeTextPlain),
+		r2.WithHeader(http.Header{"X-Something": []string{"value"}}),
+		r2.WithInterval(time.Millisecond),
+	}
+	i := 0
+	for res, err := range r2.DoFunc(context.Background(), newRequest, opts...) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if res == nil {
+			t.Fatal("response is nil")
+		}
+		i++
+	}
+	if i != 3 {
+		t.Errorf("request times got: %d, want: 3", i)
+	}
+}
+
+func TestDoFuncWithNewRequestError(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	errPresign := errors.New("failed to presign")
+	newRequest := func(attempt int) (*http.Request, error) {
+		if attempt == 1 {
+			return nil, errPresign
+		}
+		return http.NewRequest(http.MethodGet, ts.URL, nil)
+	}
+	var (
+		responses int
+		lastErr   error
+	)
+	for res, err := range r2.DoFunc(context.Background(), newRequest, r2.WithInterval(time.Millisecond)) {
+		if res != nil {
+			responses++
+		}
+		lastErr = err
+	}
+	if responses != 1 {
+		t.Errorf("request times got: %d, want: 1", responses)
+	}
+	// the error of newRequest is returned as the last error.
+	if !errors.Is(lastErr, errPresign) {
+		t.Errorf("last error got: %v, want: %v", lastErr, errPresign)
+	}
+}
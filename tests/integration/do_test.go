@@ -66,7 +66,7 @@ func TestDo(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -111,7 +111,7 @@ func TestDoWithContextCancel(t *testing.T) {
 	defer cancel()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithInterval(3*time.Minute)) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithInterval(3*time.Minute)) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -166,7 +166,7 @@ func TestDoWithMaxRequestAttempts(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithMaxRequestAttempts(2)) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithMaxRequestAttempts(2)) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -200,7 +200,7 @@ func TestDoWithPeriod(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithPeriod(10*time.Millisecond), r2.WithMaxRequestAttempts(2)) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithPeriod(10*time.Millisecond), r2.WithMaxRequestAttempts(2)) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -248,7 +248,7 @@ func TestDoWithInterval(t *testing.T) {
 	defer cancel()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithInterval(time.Minute), r2.WithMaxRequestAttempts(3)) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithInterval(time.Minute), r2.WithMaxRequestAttempts(3)) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -318,7 +318,7 @@ func TestDoWithTerminateIf(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, opts...) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, opts...) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -381,7 +381,7 @@ func TestDoWithContentType(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithContentType(r2.ContentTypeApplicationJSON)) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithContentType(r2.ContentTypeApplicationJSON)) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -443,7 +443,7 @@ func TestDoWithHeader(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithHeader(http.Header{"X-Test": []string{"test"}})) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithHeader(http.Header{"X-Test": []string{"test"}})) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		i++
 	}
@@ -484,7 +484,7 @@ func TestDoWithAspect(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithAspect(func(req *http.Request, do func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithAspect(func(req *http.Request, do func(req *http.Request) (*http.Response, error)) (*http.Response, error) {
 		testReq := RequestFromBuffer(req.Body)
 		testReq.Num += 1
 		req.Body = io.NopCloser(testReq.Encode())
@@ -547,7 +547,7 @@ func TestDoWithAutoCloseResponseBody(t *testing.T) {
 	ctx := context.Background()
 	i := 0
 	body := TestRequest{Num: 0}.Encode()
-	for res, err := range r2.Do(ctx, http.MethodPost, ts.URL, body, r2.WithAutoCloseResponseBody(false)) {
+	for res, err := range r2.Do(ctx, ts.URL, http.MethodPost, body, r2.WithAutoCloseResponseBody(false)) {
 		Cmp(t, Result{res: res, err: err}, expect[i])
 		if resBody := res.Body; resBody != nil {
 			if err := res.Body.Close(); err != nil {
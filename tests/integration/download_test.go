@@ -0,0 +1,177 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/miyamo2/r2"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDownload(t *testing.T) {
+	t.Parallel()
+	content := bytes.Repeat([]byte("0123456789"), 1000)
+	sum := sha256.Sum256(content)
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type want struct {
+		ranges []string
+		err    error
+	}
+	tests := map[string]struct {
+		etag        string
+		ignoreRange bool
+		reprDigest  string
+		opts        []r2.Option
+		want        want
+	}{
+		"resume-with-etag": {
+			etag: `"v1"`,
+			opts: []r2.Option{r2.WithChecksumSHA256(hex.EncodeToString(sum[:]))},
+			want: want{ranges: []string{"", "bytes=4000-"}},
+		},
+		"resume-with-last-modified": {
+			etag: `W/"weak"`,
+			want: want{ranges: []string{"", "bytes=4000-"}},
+		},
+		"server-ignores-range": {
+			etag:        `"v1"`,
+			ignoreRange: true,
+			want:        want{ranges: []string{"", "bytes=4000-"}},
+		},
+		"checksum-mismatch": {
+			etag: `"v1"`,
+			opts: []r2.Option{r2.WithChecksumSHA256(hex.EncodeToString(make([]byte, sha256.Size)))},
+			want: want{ranges: []string{"", "bytes=4000-"}, err: r2.ErrChecksumMismatch},
+		},
+		"repr-digest": {
+			etag:       `"v1"`,
+			reprDigest: "sha-256=:" + base64.StdEncoding.EncodeToString(sum[:]) + ":",
+			opts:       []r2.Option{r2.WithVerifyContentDigest(true)},
+			want:       want{ranges: []string{"", "bytes=4000-"}},
+		},
+		"repr-digest-mismatch": {
+			etag:       `"v1"`,
+			reprDigest: "sha-256=:" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)) + ":",
+			opts:       []r2.Option{r2.WithVerifyContentDigest(true)},
+			want:       want{ranges: []string{"", "bytes=4000-"}, err: r2.ErrContentDigestMismatch},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var ranges []string
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ranges = append(ranges, r.Header.Get("Range"))
+				w.Header().Set("ETag", tt.etag)
+				w.Header().Set("Last-Modified", modTime.Format(http.TimeFormat))
+				if tt.reprDigest != "" {
+					w.Header().Set("Repr-Digest", tt.reprDigest)
+				}
+				if len(ranges) == 1 {
+					w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+					w.WriteHeader(http.StatusOK)
+					w.Write(content[:4000])
+					w.(http.Flusher).Flush()
+					panic(http.ErrAbortHandler)
+				}
+				if want := tt.etag; want[0] != 'W' && r.Header.Get("If-Range") != want {
+					t.Errorf("If-Range got: %s, want: %s", r.Header.Get("If-Range"), want)
+				}
+				if tt.ignoreRange {
+					w.WriteHeader(http.StatusOK)
+					w.Write(content)
+					return
+				}
+				http.ServeContent(w, r, "", modTime, bytes.NewReader(content))
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			dst := filepath.Join(t.TempDir(), "file.bin")
+			opts := append([]r2.Option{r2.WithInterval(time.Millisecond)}, tt.opts...)
+			err := r2.Download(context.Background(), ts.URL, dst, opts...)
+			if !errors.Is(err, tt.want.err) {
+				t.Fatalf("error got: %v, want: %v", err, tt.want.err)
+			}
+			if len(ranges) != len(tt.want.ranges) || ranges[0] != tt.want.ranges[0] || ranges[1] != tt.want.ranges[1] {
+				t.Errorf("ranges got: %q, want: %q", ranges, tt.want.ranges)
+			}
+			got, readErr := os.ReadFile(dst)
+			if tt.want.err != nil {
+				if !errors.Is(readErr, os.ErrNotExist) {
+					t.Errorf("file is created on error")
+				}
+				return
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("content got: %d bytes, want: %d bytes", len(got), len(content))
+			}
+			// the temporary file is removed.
+			if entries, _ := os.ReadDir(filepath.Dir(dst)); len(entries) != 1 {
+				t.Errorf("files in the directory got: %d, want: 1", len(entries))
+			}
+		})
+	}
+}
+
+func TestDownloadWithFileMode(t *testing.T) {
+	t.Parallel()
+	tests := map[string]struct {
+		existing os.FileMode
+		opts     []r2.Option
+		want     os.FileMode
+	}{
+		"new-file": {
+			want: 0o600,
+		},
+		"existing-file": {
+			existing: 0o640,
+			want:     0o640,
+		},
+		"with-file-mode": {
+			existing: 0o640,
+			opts:     []r2.Option{r2.WithFileMode(0o644)},
+			want:     0o644,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("content"))
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			dst := filepath.Join(t.TempDir(), "file.bin")
+			if tt.existing != 0 {
+				if err := os.WriteFile(dst, nil, tt.existing); err != nil {
+					t.Fatal(err)
+				}
+				// the permissions are set regardless of the umask.
+				if err := os.Chmod(dst, tt.existing); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := r2.Download(context.Background(), ts.URL, dst, tt.opts...); err != nil {
+				t.Fatal(err)
+			}
+			info, err := os.Stat(dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Mode().Perm(); got != tt.want {
+				t.Errorf("file mode got: %v, want: %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	t.Parallel()
+	streams := []string{
+		": comment\nretry: 100\nid: 1\ndata: first\n\nid: 2\nevent: update\ndata: second\ndata: line\n\nid: 3\ndata: incomplete",
+		// the server resends the event 2.
+		"id: 2\nevent: update\ndata: second\ndata: line\n\nid: 3\ndata: third\n\ndata: without id\n\n",
+	}
+	var (
+		connectedAt  []time.Time
+		lastEventIDs []string
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		connectedAt = append(connectedAt, time.Now())
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		i := len(connectedAt) - 1
+		switch {
+		case i == 1:
+			// the reconnection fails once, and is retried.
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		case i >= len(streams)+1:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case i > 1:
+			i--
+		}
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, streams[i])
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var got []r2.Event
+	for event, err := range r2.Events(ctx, ts.URL, r2.WithInterval(time.Millisecond)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, event)
+	}
+	want := []r2.Event{
+		{ID: "1", Type: "message", Data: "first"},
+		{ID: "2", Type: "update", Data: "second\nline"},
+		{ID: "3", Type: "message", Data: "third"},
+		{ID: "3", Type: "message", Data: "without id"},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("events got: %v, want: %v", got, want)
+	}
+	if wantIDs := []string{"", "2", "2", "3"}; !slices.Equal(lastEventIDs, wantIDs) {
+		t.Errorf("Last-Event-ID got: %v, want: %v", lastEventIDs, wantIDs)
+	}
+	// the 'retry' field is used as the interval of the reconnection.
+	if wait := connectedAt[1].Sub(connectedAt[0]); wait < 100*time.Millisecond {
+		t.Errorf("reconnection wait got: %s, want: 100ms or more", wait)
+	}
+}
+
+func TestEventsUnexpectedStream(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, `{}`)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	i := 0
+	for _, err := range r2.Events(context.Background(), ts.URL) {
+		if !errors.Is(err, r2.ErrUnexpectedEventStream) {
+			t.Errorf("error got: %v, want: %v", err, r2.ErrUnexpectedEventStream)
+		}
+		i++
+	}
+	if i != 1 {
+		t.Errorf("yield times got: %d, want: 1", i)
+	}
+}
@@ -0,0 +1,212 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"io"
+	"iter"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// inFlight records the maximum number of the requests in flight.
+type inFlight struct {
+	current, max atomic.Int32
+}
+
+func (f *inFlight) enter() {
+	n := f.current.Add(1)
+	for {
+		m := f.max.Load()
+		if n <= m || f.max.CompareAndSwap(m, n) {
+			return
+		}
+	}
+}
+
+func (f *inFlight) leave() {
+	f.current.Add(-1)
+}
+
+// requestsOf returns the sequence of the requests.
+func requestsOf(requests ...r2.Request) iter.Seq[r2.Request] {
+	return func(yield func(r2.Request) bool) {
+		for _, req := range requests {
+			if !yield(req) {
+				return
+			}
+		}
+	}
+}
+
+func TestDoAll(t *testing.T) {
+	t.Parallel()
+	type want struct {
+		results         int
+		ordered         bool
+		maxInFlight     int32
+		maxInFlightHost int32
+	}
+	tests := map[string]struct {
+		requests    int
+		concurrency int
+		breakAfter  int
+		opts        []r2.Option
+		want        want
+	}{
+		"unordered": {
+			requests:    40,
+			concurrency: 8,
+			want:        want{results: 40, maxInFlight: 8},
+		},
+		"ordered": {
+			requests:    40,
+			concurrency: 8,
+			opts:        []r2.Option{r2.WithOrdered(true)},
+			want:        want{results: 40, ordered: true, maxInFlight: 8},
+		},
+		"per-host-concurrency": {
+			requests:    20,
+			concurrency: 8,
+			opts:        []r2.Option{r2.WithPerHostConcurrency(2)},
+			want:        want{results: 20, maxInFlight: 4, maxInFlightHost: 2},
+		},
+		"break": {
+			requests:    100,
+			concurrency: 4,
+			breakAfter:  3,
+			want:        want{results: 3, maxInFlight: 4},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				total    inFlight
+				hosts    [2]inFlight
+				requests atomic.Int32
+				urls     [2]string
+			)
+			for i := range hosts {
+				ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					requests.Add(1)
+					total.enter()
+					defer total.leave()
+					hosts[i].enter()
+					defer hosts[i].leave()
+					n, _ := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/"))
+					// the later request completes earlier.
+					time.Sleep(time.Duration(20-n%20) * time.Millisecond)
+					io.WriteString(w, strconv.Itoa(n))
+				}))
+				defer ts.Close()
+				urls[i] = ts.URL
+			}
+			seq := func(yield func(r2.Request) bool) {
+				for i := range tt.requests {
+					if !yield(r2.Request{URL: fmt.Sprintf("%s/%d", urls[i%2], i)}) {
+						return
+					}
+				}
+			}
+
+			var indexes []int
+			opts := append([]r2.Option{r2.WithInterval(time.Millisecond)}, tt.opts...)
+			for outcome := range r2.DoAll(context.Background(), iter.Seq[r2.Request](seq), tt.concurrency, opts...) {
+				if outcome.Err != nil {
+					t.Fatal(outcome.Err)
+				}
+				b, err := io.ReadAll(outcome.Response.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := fmt.Sprintf("%s/%s", urls[outcome.Index%2], b); outcome.Request.URL != want {
+					t.Errorf("request got: %s, want: %s", outcome.Request.URL, want)
+				}
+				indexes = append(indexes, outcome.Index)
+				if len(indexes) == tt.breakAfter {
+					break
+				}
+			}
+			if len(indexes) != tt.want.results {
+				t.Errorf("results got: %d, want: %d", len(indexes), tt.want.results)
+			}
+			if tt.want.ordered && !slices.IsSorted(indexes) {
+				t.Errorf("results are not ordered: %v", indexes)
+			}
+			if got := total.max.Load(); got > tt.want.maxInFlight {
+				t.Errorf("in flight got: %d, want: %d or less", got, tt.want.maxInFlight)
+			}
+			for i := range hosts {
+				if got := hosts[i].max.Load(); tt.want.maxInFlightHost != 0 && got > tt.want.maxInFlightHost {
+					t.Errorf("in flight per host got: %d, want: %d or less", got, tt.want.maxInFlightHost)
+				}
+			}
+			if got := requests.Load(); tt.breakAfter != 0 && got > int32(tt.breakAfter+tt.concurrency) {
+				t.Errorf("requests after break got: %d, want: %d or less", got, tt.breakAfter+tt.concurrency)
+			}
+		})
+	}
+}
+
+func TestDoAllWithRetry(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		attempts = map[string]int{}
+	)
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		n := attempts[r.URL.Path]
+		mu.Unlock()
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		io.WriteString(w, r.URL.Path)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	requests := requestsOf(
+		r2.Request{URL: ts.URL + "/a"},
+		r2.Request{URL: ts.URL + "/b", Method: http.MethodPost, Body: strings.NewReader("body")},
+	)
+	opts := []r2.Option{r2.WithInterval(time.Millisecond), r2.WithOrdered(true)}
+	var bodies []string
+	for outcome := range r2.DoAll(context.Background(), requests, 2, opts...) {
+		if outcome.Err != nil {
+			t.Fatal(outcome.Err)
+		}
+		b, _ := io.ReadAll(outcome.Response.Body)
+		bodies = append(bodies, string(b))
+	}
+	if !slices.Equal(bodies, []string{"/a", "/b"}) {
+		t.Errorf("bodies got: %q", bodies)
+	}
+}
+
+func TestDoAllWithInvalidURL(t *testing.T) {
+	t.Parallel()
+	requests := requestsOf(r2.Request{URL: "http://example.com/%zz"})
+	for outcome := range r2.DoAll(context.Background(), requests, 1) {
+		var urlErr *url.Error
+		if !errors.As(outcome.Err, &urlErr) {
+			t.Errorf("error got: %v, want: *url.Error", outcome.Err)
+		}
+		if outcome.Response != nil {
+			t.Errorf("response got: %v, want: nil", outcome.Response)
+		}
+	}
+}
@@ -2,9 +2,16 @@ module github.com/miyamo2/r2/tests/integration
 
 go 1.22
 
-replace github.com/miyamo2/r2 => ../../
+replace (
+	github.com/miyamo2/r2 => ../../
+	github.com/miyamo2/r2/codec/msgpack => ../../codec/msgpack
+)
 
 require (
 	github.com/google/go-cmp v0.6.0
 	github.com/miyamo2/r2 v0.0.0-00010101000000-000000000000
+	github.com/miyamo2/r2/codec/msgpack v0.0.0-00010101000000-000000000000
+	github.com/vmihailenco/msgpack/v5 v5.4.1
 )
+
+require github.com/vmihailenco/tagparser/v2 v2.0.0 // indirect
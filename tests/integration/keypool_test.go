@@ -0,0 +1,73 @@
+package integration
+
+import (
+	"context"
+	"github.com/miyamo2/r2"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestWithKeyPool(t *testing.T) {
+	t.Parallel()
+	type test struct {
+		retryAfter  map[string]string
+		wantKeys    []string
+		wantElapsed time.Duration
+	}
+	tests := map[string]test{
+		"rotate-without-waiting": {
+			retryAfter: map[string]string{"key-a": "1m"},
+			wantKeys:   []string{"key-a", "key-b"},
+		},
+		"wait-until-cooldown-if-every-key-is-cooling-down": {
+			retryAfter:  map[string]string{"key-a": "1s", "key-b": "2s"},
+			wantKeys:    []string{"key-a", "key-b", "key-a"},
+			wantElapsed: time.Second,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			keys := make([]string, 0)
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				key := r.Header.Get("X-Api-Key")
+				limited := slices.Contains(keys, key)
+				keys = append(keys, key)
+				if retryAfter, ok := tt.retryAfter[key]; ok && !limited {
+					w.Header().Set("Retry-After", retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			pool := r2.NewKeyPool(func(key string) r2.Credential {
+				return r2.HeaderValue("X-Api-Key", key)
+			}, "key-a", "key-b")
+			opts := []r2.Option{
+				r2.WithKeyPool(pool),
+				r2.WithInterval(time.Minute),
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			start := time.Now()
+			for _, err := range r2.Get(ctx, ts.URL, opts...) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+			}
+			elapsed := time.Since(start)
+			if !slices.Equal(keys, tt.wantKeys) {
+				t.Errorf("keys got: %v, want: %v", keys, tt.wantKeys)
+			}
+			if elapsed < tt.wantElapsed || elapsed > tt.wantElapsed+time.Second {
+				t.Errorf("elapsed got: %v, want: %v", elapsed, tt.wantElapsed)
+			}
+		})
+	}
+}
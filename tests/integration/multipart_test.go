@@ -0,0 +1,97 @@
+package integration
+
+import (
+	"context"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestPostMultipart(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "from-path.txt")
+	if err := os.WriteFile(path, []byte("content from path"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{
+		"dir/from-fs.txt": &fstest.MapFile{Data: []byte("content from fs")},
+	}
+	readerAt := strings.NewReader("content from reader-at")
+
+	form := r2.NewMultipartForm().
+		AddField("name", "r2").
+		AddFile("path", path).
+		AddFileFS("fs", fsys, "dir/from-fs.txt").
+		AddReaderAt("reader-at", "from-reader-at.txt", readerAt, readerAt.Size())
+	wantContentLength, err := form.ContentLength()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantFiles := map[string]struct {
+		filename string
+		content  string
+	}{
+		"path":      {filename: "from-path.txt", content: "content from path"},
+		"fs":        {filename: "from-fs.txt", content: "content from fs"},
+		"reader-at": {filename: "from-reader-at.txt", content: "content from reader-at"},
+	}
+	boundaries := map[string]struct{}{}
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		if r.ContentLength != wantContentLength {
+			t.Errorf("Content-Length got: %d, want: %d", r.ContentLength, wantContentLength)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Fatal(err)
+		}
+		boundaries[r.Header.Get("Content-Type")] = struct{}{}
+		if got, want := r.FormValue("name"), "r2"; got != want {
+			t.Errorf("name got: %s, want: %s", got, want)
+		}
+		for field, want := range wantFiles {
+			f, header, err := r.FormFile(field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(f)
+			f.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Filename != want.filename {
+				t.Errorf("filename of %s got: %s, want: %s", field, header.Filename, want.filename)
+			}
+			if string(b) != want.content {
+				t.Errorf("content of %s got: %s, want: %s", field, b, want.content)
+			}
+		}
+		if reqTimes < 2 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	for _, err := range r2.PostMultipart(context.Background(), ts.URL, form, r2.WithInterval(time.Millisecond)) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if reqTimes != 3 {
+		t.Errorf("request times got: %d, want: 3", reqTimes)
+	}
+	if len(boundaries) != 1 {
+		t.Errorf("boundary changed between attempts: %v", boundaries)
+	}
+}
@@ -0,0 +1,169 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPollOperation(t *testing.T) {
+	t.Parallel()
+	type response struct {
+		status int
+		header map[string]string
+		body   string
+	}
+	type want struct {
+		status int
+		body   string
+		err    error
+	}
+	tests := map[string]struct {
+		start  response
+		polls  []response
+		opts   []r2.Option
+		wants  []want
+		waitAt int
+	}{
+		"succeeded-with-resource-location": {
+			start: response{status: http.StatusAccepted, header: map[string]string{"Operation-Location": "/operations/1", "Location": "/ignored"}},
+			polls: []response{
+				{status: http.StatusAccepted, header: map[string]string{"Retry-After": "100ms"}},
+				{status: http.StatusOK, body: `{"status":"running"}`},
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusOK, body: `{"status":"succeeded","resourceLocation":"/resource"}`},
+			},
+			wants: []want{
+				{status: http.StatusAccepted},
+				{status: http.StatusAccepted},
+				{status: http.StatusOK, body: `{"status":"running"}`},
+				{status: http.StatusServiceUnavailable},
+				{status: http.StatusOK, body: `{"status":"succeeded","resourceLocation":"/resource"}`},
+				{status: http.StatusOK, body: "resource"},
+			},
+			waitAt: 2,
+		},
+		"succeeded-without-resource-location": {
+			start: response{status: http.StatusAccepted, header: map[string]string{"Location": "/operations/1"}},
+			polls: []response{
+				{status: http.StatusAccepted},
+				{status: http.StatusOK, body: "resource"},
+			},
+			wants: []want{
+				{status: http.StatusAccepted},
+				{status: http.StatusAccepted},
+				{status: http.StatusOK, body: "resource"},
+			},
+		},
+		"failed": {
+			start: response{status: http.StatusAccepted, header: map[string]string{"Location": "/operations/1"}},
+			polls: []response{
+				{status: http.StatusOK, body: `{"status":"Failed"}`},
+			},
+			wants: []want{
+				{status: http.StatusAccepted},
+				{status: http.StatusOK, body: `{"status":"Failed"}`, err: r2.ErrOperationFailed},
+			},
+		},
+		"custom-status-extractor": {
+			start: response{status: http.StatusAccepted, header: map[string]string{"Location": "/operations/1"}},
+			polls: []response{
+				{status: http.StatusOK, header: map[string]string{"X-State": "InProgress"}},
+				{status: http.StatusOK, header: map[string]string{"X-State": "Done"}},
+			},
+			opts: []r2.Option{
+				r2.WithStatusExtractor(func(res *http.Response) (r2.OperationStatus, error) {
+					if res.Header.Get("X-State") == "Done" {
+						return r2.OperationStatus{State: r2.OperationSucceeded, ResourceLocation: "/resource"}, nil
+					}
+					return r2.OperationStatus{State: r2.OperationRunning}, nil
+				}),
+			},
+			wants: []want{
+				{status: http.StatusAccepted},
+				{status: http.StatusOK},
+				{status: http.StatusOK},
+				{status: http.StatusOK, body: "resource"},
+			},
+		},
+		"completed-synchronously": {
+			start: response{status: http.StatusOK, body: "resource"},
+			wants: []want{
+				{status: http.StatusOK, body: "resource"},
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			pollTimes := 0
+			var requestedAt []time.Time
+			write := func(w http.ResponseWriter, res response) {
+				for k, v := range res.header {
+					w.Header().Set(k, v)
+				}
+				w.WriteHeader(res.status)
+				fmt.Fprint(w, res.body)
+			}
+			mux := http.NewServeMux()
+			mux.HandleFunc("POST /operations", func(w http.ResponseWriter, r *http.Request) {
+				requestedAt = append(requestedAt, time.Now())
+				write(w, tt.start)
+			})
+			mux.HandleFunc("GET /operations/1", func(w http.ResponseWriter, r *http.Request) {
+				requestedAt = append(requestedAt, time.Now())
+				defer func() { pollTimes++ }()
+				write(w, tt.polls[pollTimes])
+			})
+			mux.HandleFunc("GET /resource", func(w http.ResponseWriter, r *http.Request) {
+				requestedAt = append(requestedAt, time.Now())
+				write(w, response{status: http.StatusOK, body: "resource"})
+			})
+			ts := httptest.NewServer(mux)
+			defer ts.Close()
+
+			opts := append([]r2.Option{
+				r2.WithPollInterval(time.Millisecond),
+				r2.WithInterval(time.Millisecond),
+			}, tt.opts...)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			i := 0
+			for res, err := range r2.PollOperation(ctx, ts.URL+"/operations", http.MethodPost, nil, opts...) {
+				if i >= len(tt.wants) {
+					t.Fatalf("request times got: %d or more, want: %d", i+1, len(tt.wants))
+				}
+				want := tt.wants[i]
+				if !errors.Is(err, want.err) {
+					t.Errorf("error of #%d got: %v, want: %v", i, err, want.err)
+				}
+				if res.StatusCode != want.status {
+					t.Errorf("status of #%d got: %d, want: %d", i, res.StatusCode, want.status)
+				}
+				// the body read by the status extractor is restored.
+				b, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(b) != want.body {
+					t.Errorf("body of #%d got: %s, want: %s", i, b, want.body)
+				}
+				i++
+			}
+			if i != len(tt.wants) {
+				t.Errorf("request times got: %d, want: %d", i, len(tt.wants))
+			}
+			if tt.waitAt > 0 {
+				if wait := requestedAt[tt.waitAt].Sub(requestedAt[tt.waitAt-1]); wait < 100*time.Millisecond {
+					t.Errorf("wait got: %s, want: 100ms or more", wait)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestPages(t *testing.T) {
+	t.Parallel()
+	items := [][]string{{"a", "b"}, {"c", "d"}, {"e"}}
+	tests := map[string]struct {
+		firstPath string
+		strategy  r2.PageStrategy
+		// page returns the index of the page, and writes the response of it.
+		page     func(w http.ResponseWriter, r *http.Request) int
+		wantReqs []string
+	}{
+		"LinkNextStrategy": {
+			firstPath: "/items",
+			strategy:  r2.LinkNextStrategy(),
+			page: func(w http.ResponseWriter, r *http.Request) int {
+				i, _ := strconv.Atoi(r.URL.Query().Get("p"))
+				if i < len(items)-1 {
+					w.Header().Add("Link", fmt.Sprintf(`</items?p=0>; rel="first", </items?p=%d>; rel="next"`, i+1))
+				}
+				return i
+			},
+			wantReqs: []string{"/items", "/items?p=1", "/items?p=1", "/items?p=2"},
+		},
+		"CursorStrategy": {
+			firstPath: "/items?limit=2",
+			strategy:  r2.CursorStrategy("$.meta.next", "cursor"),
+			page: func(w http.ResponseWriter, r *http.Request) int {
+				cursors := map[string]int{"": 0, "c1": 1, "c2": 2}
+				return cursors[r.URL.Query().Get("cursor")]
+			},
+			wantReqs: []string{"/items?limit=2", "/items?cursor=c1&limit=2", "/items?cursor=c1&limit=2", "/items?cursor=c2&limit=2"},
+		},
+		"OffsetStrategy": {
+			firstPath: "/items",
+			strategy:  r2.OffsetStrategy("offset", "items"),
+			page: func(w http.ResponseWriter, r *http.Request) int {
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				return map[int]int{0: 0, 2: 1, 4: 2, 5: 3}[offset]
+			},
+			wantReqs: []string{"/items", "/items?offset=2", "/items?offset=2", "/items?offset=4", "/items?offset=5"},
+		},
+		"PageNumberStrategy": {
+			firstPath: "/items?page=1",
+			strategy:  r2.PageNumberStrategy("page", "$.items"),
+			page: func(w http.ResponseWriter, r *http.Request) int {
+				page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+				return page - 1
+			},
+			wantReqs: []string{"/items?page=1", "/items?page=2", "/items?page=2", "/items?page=3", "/items?page=4"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var gotReqs []string
+			failed := false
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotReqs = append(gotReqs, r.URL.RequestURI())
+				i := tt.page(w, r)
+				// the second page fails once.
+				if i == 1 && !failed {
+					failed = true
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				var page []string
+				if i < len(items) {
+					page = items[i]
+				}
+				next := ""
+				if i < len(items)-1 {
+					next = fmt.Sprintf("c%d", i+1)
+				}
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprintf(w, `{"items":%s,"meta":{"next":%q}}`, jsonStrings(page), next)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			var gotBodies []string
+			for res, err := range r2.Pages(context.Background(), ts.URL+tt.firstPath, tt.strategy, r2.WithInterval(time.Millisecond)) {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if res.StatusCode != http.StatusOK {
+					continue
+				}
+				// the body read by the strategy is restored.
+				b, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				gotBodies = append(gotBodies, string(b))
+			}
+			if fmt.Sprint(gotReqs) != fmt.Sprint(tt.wantReqs) {
+				t.Errorf("requests got: %v, want: %v", gotReqs, tt.wantReqs)
+			}
+			if len(gotBodies) != len(tt.wantReqs)-1 {
+				t.Errorf("pages got: %d, want: %d", len(gotBodies), len(tt.wantReqs)-1)
+			}
+		})
+	}
+}
+
+func jsonStrings(s []string) string {
+	b := []byte("[")
+	for i, v := range s {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		b = strconv.AppendQuote(b, v)
+	}
+	return string(append(b, ']'))
+}
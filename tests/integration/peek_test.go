@@ -0,0 +1,85 @@
+package integration
+
+import (
+	"context"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithPeekLimit(t *testing.T) {
+	t.Parallel()
+	body := `{"status":"done"}` + strings.Repeat("x", 1<<16)
+	type want struct {
+		peeked  string
+		reqTime int
+	}
+	tests := map[string]struct {
+		opts []r2.Option
+		want want
+	}{
+		"limited": {
+			opts: []r2.Option{r2.WithPeekLimit(17)},
+			want: want{peeked: `{"status":"done"}`, reqTime: 1},
+		},
+		"unlimited": {
+			opts: []r2.Option{r2.WithPeekLimit(0)},
+			want: want{peeked: body, reqTime: 1},
+		},
+		"header-only": {
+			opts: []r2.Option{r2.WithHeaderOnlyInspection(true), r2.WithPeekLimit(17)},
+			want: want{peeked: "", reqTime: 3},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				io.WriteString(w, body)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			var peeked []string
+			cond := func(res *http.Response, _ error) bool {
+				b, _ := io.ReadAll(res.Body)
+				peeked = append(peeked, string(b))
+				return strings.HasPrefix(string(b), `{"status":"done"}`)
+			}
+			opts := append([]r2.Option{
+				r2.WithTerminateIf(cond),
+				r2.WithMaxRequestAttempts(3),
+				r2.WithInterval(time.Millisecond),
+			}, tt.opts...)
+			reqTimes := 0
+			for res, err := range r2.Get(context.Background(), ts.URL, opts...) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				// the consumer receives the whole body regardless of the peek limit.
+				b, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				res.Body.Close()
+				if string(b) != body {
+					t.Errorf("body got: %d bytes, want: %d bytes", len(b), len(body))
+				}
+				reqTimes++
+			}
+			if reqTimes != tt.want.reqTime {
+				t.Errorf("request times got: %d, want: %d", reqTimes, tt.want.reqTime)
+			}
+			for _, got := range peeked {
+				if got != tt.want.peeked {
+					t.Errorf("peeked got: %d bytes, want: %d bytes", len(got), len(tt.want.peeked))
+				}
+			}
+		})
+	}
+}
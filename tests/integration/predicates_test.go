@@ -0,0 +1,121 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"github.com/miyamo2/r2/predicates"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWithTerminateIfPredicates(t *testing.T) {
+	t.Parallel()
+	// the 3rd response is the one that satisfies all the conditions.
+	responses := []struct {
+		status int
+		header http.Header
+		body   string
+	}{
+		{status: http.StatusAccepted, body: `{"job":{"status":"running","progress":0.5}}`},
+		{status: http.StatusOK, body: `{"job":{"status":"running","progress":0.9}}`},
+		{status: http.StatusOK, header: http.Header{"X-Job-State": []string{"done"}}, body: `{"job":{"status":"done","progress":1,"items":[{"id":1},{"id":2}]}}`},
+	}
+	tests := map[string]struct {
+		cond         r2.TerminationCondition
+		wantReqTimes int
+	}{
+		"StatusIn": {
+			cond:         predicates.StatusIn(http.StatusOK),
+			wantReqTimes: 2,
+		},
+		"HeaderEquals": {
+			cond:         predicates.HeaderEquals("X-Job-State", "done"),
+			wantReqTimes: 3,
+		},
+		"HeaderPresent": {
+			cond:         predicates.HeaderPresent("X-Job-State"),
+			wantReqTimes: 3,
+		},
+		"BodyContains": {
+			cond:         predicates.BodyContains(`"progress":0.9`),
+			wantReqTimes: 2,
+		},
+		"JSONPathEquals": {
+			cond:         predicates.JSONPathEquals("$.job.items[1].id", 2),
+			wantReqTimes: 3,
+		},
+		"JSONField": {
+			cond: predicates.JSONField("job.progress", func(progress float64) bool {
+				return progress > 0.8
+			}),
+			wantReqTimes: 2,
+		},
+		"AnyOf": {
+			cond: predicates.AnyOf(
+				predicates.BodyContains("unknown"),
+				predicates.JSONPathEquals("$.job.progress", 0.9),
+			),
+			wantReqTimes: 2,
+		},
+		"AllOf": {
+			cond: predicates.AllOf(
+				predicates.StatusIn(http.StatusOK),
+				predicates.BodyContains("running"),
+				predicates.JSONPathEquals("$.job.progress", 0.9),
+			),
+			wantReqTimes: 2,
+		},
+		"Not": {
+			cond: predicates.AllOf(
+				predicates.StatusIn(http.StatusOK),
+				predicates.Not(predicates.JSONPathEquals("$.job.status", "running")),
+			),
+			wantReqTimes: 3,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				res := responses[reqTimes]
+				for k, v := range res.header {
+					w.Header()[k] = v
+				}
+				w.WriteHeader(res.status)
+				fmt.Fprint(w, res.body)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := []r2.Option{
+				r2.WithTerminateIf(tt.cond),
+				r2.WithMaxRequestAttempts(len(responses)),
+				r2.WithInterval(time.Millisecond),
+			}
+			i := 0
+			for res, err := range r2.Get(context.Background(), ts.URL, opts...) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				// the consumer still receives the unread body.
+				b, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := string(b), responses[i].body; got != want {
+					t.Errorf("body got: %s, want: %s", got, want)
+				}
+				i++
+			}
+			if i != tt.wantReqTimes {
+				t.Errorf("request times got: %d, want: %d", i, tt.wantReqTimes)
+			}
+		})
+	}
+}
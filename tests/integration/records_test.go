@@ -0,0 +1,207 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type record struct {
+	ID int `json:"id"`
+}
+
+// dropAfter writes the first n bytes of the body with the 'Content-Length' of the whole body, and drops the connection.
+func dropAfter(w http.ResponseWriter, body string, n int) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(body[:n]))
+	w.(http.Flusher).Flush()
+	panic(http.ErrAbortHandler)
+}
+
+// serveRange writes the body from the offset in 'Range' header.
+func serveRange(t *testing.T, w http.ResponseWriter, r *http.Request, body string, wantOffset int) {
+	if got, want := r.Header.Get("Range"), fmt.Sprintf("bytes=%d-", wantOffset); got != want {
+		t.Errorf("Range got: %s, want: %s", got, want)
+	}
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", wantOffset, len(body)-1, len(body)))
+	w.WriteHeader(http.StatusPartialContent)
+	fmt.Fprint(w, body[wantOffset:])
+}
+
+func TestGetNDJSON(t *testing.T) {
+	t.Parallel()
+	body := "{\"id\":1}\n\n{\"id\":2}\n{\"id\":3}"
+	tests := map[string]struct {
+		resume r2.ResumeFunc[record]
+		resp   func(t *testing.T, w http.ResponseWriter, r *http.Request)
+	}{
+		"range": {
+			resume: r2.ResumeWithRange[record](),
+			resp: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				// the connection drops in the middle of the 3rd record.
+				serveRange(t, w, r, body, strings.Index(body, `{"id":3}`))
+			},
+		},
+		"range-ignored": {
+			resume: r2.ResumeWithRange[record](),
+			resp: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Range") == "" {
+					t.Error("Range is not sent")
+				}
+				// the records delivered so far are skipped.
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, body)
+			},
+		},
+		"cursor": {
+			resume: r2.ResumeWithCursor("after", func(last record) string {
+				return strconv.Itoa(last.ID)
+			}),
+			resp: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if got, want := r.URL.Query().Get("after"), "2"; got != want {
+					t.Errorf("cursor got: %s, want: %s", got, want)
+				}
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, "{\"id\":3}\n")
+			},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				if reqTimes == 0 {
+					dropAfter(w, body, len(body)-3)
+				}
+				tt.resp(t, w, r)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			var got []record
+			for v, err := range r2.GetNDJSON(context.Background(), ts.URL, tt.resume, r2.WithInterval(time.Millisecond)) {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				got = append(got, v)
+			}
+			if want := []record{{1}, {2}, {3}}; !slices.Equal(got, want) {
+				t.Errorf("records got: %v, want: %v", got, want)
+			}
+			if reqTimes != 2 {
+				t.Errorf("request times got: %d, want: 2", reqTimes)
+			}
+		})
+	}
+}
+
+func TestGetJSONArray(t *testing.T) {
+	t.Parallel()
+	body := `[ {"id":1}, {"id":2} ,{"id":3}]`
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		if reqTimes == 0 {
+			// the connection drops in the middle of the 3rd record.
+			dropAfter(w, body, strings.Index(body, `{"id":3}`)+3)
+		}
+		serveRange(t, w, r, body, strings.Index(body, `{"id":2}`)+len(`{"id":2}`))
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var got []record
+	for v, err := range r2.GetJSONArray(context.Background(), ts.URL, r2.ResumeWithRange[record](), r2.WithInterval(time.Millisecond)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, v)
+	}
+	if want := []record{{1}, {2}, {3}}; !slices.Equal(got, want) {
+		t.Errorf("records got: %v, want: %v", got, want)
+	}
+	if reqTimes != 2 {
+		t.Errorf("request times got: %d, want: 2", reqTimes)
+	}
+}
+
+func TestGetCSV(t *testing.T) {
+	t.Parallel()
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		if reqTimes == 0 {
+			dropAfter(w, "id,name\n1,a\n2,b\n3,c\n", len("id,name\n1,a\n2,b\n3,"))
+		}
+		if got, want := r.URL.Query().Get("offset"), "2"; got != want {
+			t.Errorf("offset got: %s, want: %s", got, want)
+		}
+		// the header of the resumed response is skipped.
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprint(w, "id,name\n3,c\n")
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var got []string
+	for v, err := range r2.GetCSV(context.Background(), ts.URL, true, r2.ResumeWithOffset[[]string]("offset"), r2.WithInterval(time.Millisecond)) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		got = append(got, strings.Join(v, ","))
+	}
+	if want := []string{"id,name", "1,a", "2,b", "3,c"}; !slices.Equal(got, want) {
+		t.Errorf("records got: %v, want: %v", got, want)
+	}
+}
+
+func TestGetNDJSONWithoutResume(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		dropAfter(w, "{\"id\":1}\n{\"id\":2}\n", 12)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var (
+		got  []record
+		errs int
+	)
+	for v, err := range r2.GetNDJSON[record](context.Background(), ts.URL, nil) {
+		if err != nil {
+			errs++
+			continue
+		}
+		got = append(got, v)
+	}
+	if want := []record{{1}}; !slices.Equal(got, want) {
+		t.Errorf("records got: %v, want: %v", got, want)
+	}
+	if errs != 1 {
+		t.Errorf("errors got: %d, want: 1", errs)
+	}
+}
+
+func TestGetNDJSONWithInvalidURL(t *testing.T) {
+	t.Parallel()
+	var errs []error
+	for _, err := range r2.GetNDJSON[record](context.Background(), "http://example.com/%zz", r2.ResumeWithRange[record]()) {
+		errs = append(errs, err)
+	}
+	var urlErr *url.Error
+	if len(errs) != 1 || !errors.As(errs[0], &urlErr) {
+		t.Errorf("errors got: %v, want: one *url.Error", errs)
+	}
+}
@@ -0,0 +1,137 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOpenRemote(t *testing.T) {
+	t.Parallel()
+	content := bytes.Repeat([]byte("abcdefghij"), 100)
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	type want struct {
+		gets    int
+		openErr error
+		readErr error
+	}
+	tests := map[string]struct {
+		// changeAfter is the number of GET requests after which the resource is changed. 0 means never.
+		changeAfter int
+		opts        []r2.Option
+		want        want
+	}{
+		"without-cache": {
+			want: want{gets: 4},
+		},
+		"with-cache": {
+			opts: []r2.Option{r2.WithBlockCache(256, 4)},
+			// the blocks 0, 1 and 3 are requested once each.
+			want: want{gets: 3},
+		},
+		"resource-changed": {
+			changeAfter: 1,
+			want:        want{gets: 2, readErr: r2.ErrResourceChanged},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var (
+				mu   sync.Mutex
+				gets int
+			)
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				if r.Method == http.MethodGet {
+					gets++
+				}
+				changed := tt.changeAfter != 0 && gets > tt.changeAfter
+				mu.Unlock()
+				if changed {
+					w.Header().Set("ETag", `"v2"`)
+					http.ServeContent(w, r, "", modTime.Add(time.Hour), bytes.NewReader(bytes.ToUpper(content)))
+					return
+				}
+				w.Header().Set("ETag", `"v1"`)
+				http.ServeContent(w, r, "", modTime, bytes.NewReader(content))
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := append([]r2.Option{r2.WithInterval(time.Millisecond)}, tt.opts...)
+			f, err := r2.OpenRemote(context.Background(), ts.URL+"/files/file.bin", opts...)
+			if !errors.Is(err, tt.want.openErr) {
+				t.Fatalf("open error got: %v, want: %v", err, tt.want.openErr)
+			}
+			defer f.Close()
+
+			info, err := f.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Name() != "file.bin" || info.Size() != int64(len(content)) || !info.ModTime().Equal(modTime) {
+				t.Errorf("stat got: %s %d %v", info.Name(), info.Size(), info.ModTime())
+			}
+
+			var readErr error
+			read := func(off int64, size int) {
+				if readErr != nil {
+					return
+				}
+				p := make([]byte, size)
+				n, err := f.ReadAt(p, off)
+				if err != nil && !errors.Is(err, io.EOF) {
+					readErr = err
+					return
+				}
+				if !bytes.Equal(p[:n], content[off:off+int64(n)]) {
+					t.Errorf("content at %d does not match", off)
+				}
+			}
+			// the zero-length read sends no request.
+			read(50, 0)
+			read(10, 100)
+			read(200, 100)
+			read(100, 10)
+			read(900, 200)
+			if !errors.Is(readErr, tt.want.readErr) {
+				t.Fatalf("read error got: %v, want: %v", readErr, tt.want.readErr)
+			}
+			if readErr != nil {
+				var changedErr *r2.RemoteChangedError
+				if !errors.As(readErr, &changedErr) || changedErr.Validator != `"v1"` {
+					t.Errorf("error got: %#v, want: *r2.RemoteChangedError", readErr)
+				}
+			}
+			if gets != tt.want.gets {
+				t.Errorf("GET requests got: %d, want: %d", gets, tt.want.gets)
+			}
+			if readErr != nil {
+				return
+			}
+
+			// read the whole resource with io.ReadSeeker.
+			if _, err := f.Seek(-int64(len(content)), io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := f.Read(nil); n != 0 || err != nil {
+				t.Errorf("zero-length read got: %d, %v, want: 0, nil", n, err)
+			}
+			got, err := io.ReadAll(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("content got: %d bytes, want: %d bytes", len(got), len(content))
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRetryAttempt(t *testing.T) {
+	t.Parallel()
+	type item struct {
+		Name string `json:"name"`
+	}
+	tests := map[string]struct {
+		bodies       []string
+		maxAttempts  int
+		wantReqTimes int
+		wantItem     item
+	}{
+		"retry-until-decoded": {
+			bodies:       []string{`{"name":`, `{"na`, `{"name":"r2"}`},
+			maxAttempts:  5,
+			wantReqTimes: 3,
+			wantItem:     item{Name: "r2"},
+		},
+		"max-request-attempts": {
+			bodies:       []string{`{"name":`, `{"na`, `{"name":"r2"}`},
+			maxAttempts:  2,
+			wantReqTimes: 2,
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reqTimes := 0
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				w.WriteHeader(http.StatusOK)
+				fmt.Fprint(w, tt.bodies[reqTimes])
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := []r2.Option{
+				r2.WithMaxRequestAttempts(tt.maxAttempts),
+				r2.WithInterval(time.Millisecond),
+			}
+			var got item
+			for res, err := range r2.Get(context.Background(), ts.URL, opts...) {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+					if !r2.RetryAttempt(res, err) {
+						t.Errorf("RetryAttempt got: false, want: true")
+					}
+					continue
+				}
+			}
+			if reqTimes != tt.wantReqTimes {
+				t.Errorf("request times got: %d, want: %d", reqTimes, tt.wantReqTimes)
+			}
+			if got != tt.wantItem {
+				t.Errorf("item got: %v, want: %v", got, tt.wantItem)
+			}
+		})
+	}
+}
+
+func TestRetryAttemptOutsideLoop(t *testing.T) {
+	t.Parallel()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	var last *http.Response
+	for res, _ := range r2.Get(context.Background(), ts.URL) {
+		last = res
+	}
+	if r2.RetryAttempt(last, nil) {
+		t.Errorf("RetryAttempt got: true, want: false")
+	}
+	if r2.RetryAttempt(nil, nil) {
+		t.Errorf("RetryAttempt got: true, want: false")
+	}
+}
@@ -0,0 +1,301 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithMessageSignature(t *testing.T) {
+	t.Parallel()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := []byte("secret")
+
+	type test struct {
+		signer     r2.Signer
+		components []string
+		verify     func(base, sig []byte) bool
+		wantInput  string
+	}
+	tests := map[string]test{
+		"ed25519": {
+			signer: r2.NewEd25519Signer("test-key-ed25519", edKey),
+			verify: func(base, sig []byte) bool {
+				return ed25519.Verify(edKey.Public().(ed25519.PublicKey), base, sig)
+			},
+			wantInput: `("@method" "@target-uri" "content-digest")`,
+		},
+		"ecdsa-p256-sha256": {
+			signer:     r2.NewECDSAP256Signer("test-key-ecdsa", ecKey),
+			components: []string{r2.ComponentMethod, r2.ComponentAuthority, r2.ComponentPath, r2.ComponentQuery, "content-type"},
+			verify: func(base, sig []byte) bool {
+				digest := sha256.Sum256(base)
+				r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+				return ecdsa.Verify(&ecKey.PublicKey, digest[:], r, s)
+			},
+			wantInput: `("@method" "@authority" "@path" "@query" "content-type")`,
+		},
+		"rsa-pss-sha512": {
+			signer: r2.NewRSAPSSSigner("test-key-rsa-pss", rsaKey),
+			verify: func(base, sig []byte) bool {
+				digest := sha512.Sum512(base)
+				return rsa.VerifyPSS(&rsaKey.PublicKey, crypto.SHA512, digest[:], sig, &rsa.PSSOptions{SaltLength: 64, Hash: crypto.SHA512}) == nil
+			},
+			wantInput: `("@method" "@target-uri" "content-digest")`,
+		},
+		"hmac-sha256": {
+			signer: r2.NewHMACSigner("test-key-hmac", hmacKey),
+			verify: func(base, sig []byte) bool {
+				mac := hmac.New(sha256.New, hmacKey)
+				mac.Write(base)
+				return hmac.Equal(mac.Sum(nil), sig)
+			},
+			wantInput: `("@method" "@target-uri" "content-digest")`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			reqTimes := 0
+			created := make([]string, 0, 2)
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				defer func() { reqTimes++ }()
+				body, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				digest := sha256.Sum256(body)
+				if got, want := r.Header.Get("Content-Digest"), fmt.Sprintf("sha-256=:%s:", base64.StdEncoding.EncodeToString(digest[:])); got != want {
+					t.Errorf("Content-Digest got: %s, want: %s", got, want)
+				}
+				input := strings.TrimPrefix(r.Header.Get("Signature-Input"), "sig1=")
+				if !strings.HasPrefix(input, tt.wantInput) {
+					t.Errorf("Signature-Input got: %s, want prefix: %s", input, tt.wantInput)
+				}
+				if !strings.Contains(input, fmt.Sprintf(`;keyid="%s";alg="%s"`, tt.signer.KeyID(), tt.signer.Algorithm())) {
+					t.Errorf("Signature-Input does not contain keyid and alg: %s", input)
+				}
+				created = append(created, input[strings.Index(input, "created="):])
+				sig, err := base64.StdEncoding.DecodeString(strings.Trim(strings.TrimPrefix(r.Header.Get("Signature"), "sig1="), ":"))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !tt.verify(signatureBase(t, r, input), sig) {
+					t.Errorf("invalid signature at attempt %d", reqTimes)
+				}
+				if reqTimes == 0 {
+					w.WriteHeader(http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			opts := []r2.Option{
+				r2.WithMessageSignature(tt.signer, tt.components...),
+				r2.WithContentDigest(r2.DigestAlgorithmSHA256),
+				r2.WithContentType(r2.ContentTypeApplicationJSON),
+				r2.WithInterval(time.Second),
+			}
+			i := 0
+			for res, err := range r2.Post(context.Background(), ts.URL+"/foo?bar=baz", TestRequest{Num: 1}.Encode(), opts...) {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				if res == nil {
+					t.Fatal("response is nil")
+				}
+				i++
+			}
+			if i != 2 {
+				t.Errorf("request times got: %d, want: 2", i)
+			}
+			if len(created) == 2 && created[0] == created[1] {
+				t.Errorf("request was not re-signed: %v", created)
+			}
+		})
+	}
+}
+
+func TestWithVerifyContentDigest(t *testing.T) {
+	t.Parallel()
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		body := []byte("test")
+		digest := sha256.Sum256(body)
+		switch reqTimes {
+		case 0:
+			w.Header().Set("Content-Digest", "sha-256=:AAAA:")
+		default:
+			w.Header().Set("Content-Digest", fmt.Sprintf("sha-256=:%s:", base64.StdEncoding.EncodeToString(digest[:])))
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write(body)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	wants := []error{r2.ErrContentDigestMismatch, nil}
+	i := 0
+	for res, err := range r2.Get(context.Background(), ts.URL, r2.WithVerifyContentDigest(true), r2.WithInterval(time.Millisecond)) {
+		if i >= len(wants) {
+			t.Fatalf("unexpected request times: %d", i+1)
+		}
+		if !errors.Is(err, wants[i]) {
+			t.Errorf("error got: %v, want: %v", err, wants[i])
+		}
+		b, err := io.ReadAll(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, []byte("test")) {
+			t.Errorf("Body got: %s, want: test", b)
+		}
+		i++
+	}
+	if i != len(wants) {
+		t.Errorf("request times got: %d, want: %d", i, len(wants))
+	}
+}
+
+// signatureBase returns the signature base of the received request.
+func signatureBase(t *testing.T, r *http.Request, params string) []byte {
+	t.Helper()
+	list := params[1:strings.Index(params, ")")]
+	base := bytes.Buffer{}
+	for _, c := range strings.Fields(list) {
+		c, err := strconv.Unquote(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v string
+		switch c {
+		case "@method":
+			v = r.Method
+		case "@target-uri":
+			v = "http://" + r.Host + r.RequestURI
+		case "@authority":
+			v = r.Host
+		case "@path":
+			v = r.URL.Path
+		case "@query":
+			v = "?" + r.URL.RawQuery
+		default:
+			v = r.Header.Get(c)
+		}
+		fmt.Fprintf(&base, "%q: %s\n", c, v)
+	}
+	fmt.Fprintf(&base, "\"@signature-params\": %s", params)
+	return base.Bytes()
+}
+
+func TestWithMessageSignatureWithWrongCurve(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reqTimes++
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	opts := []r2.Option{
+		r2.WithMessageSignature(r2.NewECDSAP256Signer("test-key-ecdsa", key)),
+		r2.WithMaxRequestAttempts(1),
+	}
+	errs := 0
+	for _, err := range r2.Get(context.Background(), ts.URL, opts...) {
+		if err != nil {
+			errs++
+		}
+	}
+	if errs != 1 {
+		t.Errorf("errors got: %d, want: 1", errs)
+	}
+	// the request is not sent without the signature.
+	if reqTimes != 0 {
+		t.Errorf("request times got: %d, want: 0", reqTimes)
+	}
+}
+
+func TestWithContentDigestWithDoFunc(t *testing.T) {
+	t.Parallel()
+	reqTimes := 0
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() { reqTimes++ }()
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(b), fmt.Sprintf("nonce-%d", reqTimes); got != want {
+			t.Errorf("Body got: %s, want: %s", got, want)
+		}
+		sum := sha256.Sum256(b)
+		if got, want := r.Header.Get("Content-Digest"), "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":"; got != want {
+			t.Errorf("Content-Digest got: %s, want: %s", got, want)
+		}
+		if reqTimes == 0 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	ts := httptest.NewServer(h)
+	defer ts.Close()
+
+	newRequest := func(attempt int) (*http.Request, error) {
+		// the body is streamed from a reader that can not be rewound.
+		body := io.MultiReader(strings.NewReader(fmt.Sprintf("nonce-%d", attempt)))
+		return http.NewRequest(http.MethodPost, ts.URL, body)
+	}
+	opts := []r2.Option{
+		r2.WithContentDigest(r2.DigestAlgorithmSHA256),
+		r2.WithInterval(time.Millisecond),
+	}
+	for _, err := range r2.DoFunc(context.Background(), newRequest, opts...) {
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if reqTimes != 2 {
+		t.Errorf("request times got: %d, want: 2", reqTimes)
+	}
+}
@@ -0,0 +1,213 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// tusServer is the in-process tus 1.0 server with the creation and checksum extensions.
+type tusServer struct {
+	mu       sync.Mutex
+	length   int64
+	data     []byte
+	metadata string
+	// fault is called before each PATCH is handled, and returns true if it handled the request instead of the server.
+	fault   func(w http.ResponseWriter, r *http.Request, patches int) bool
+	patches int
+	heads   int
+}
+
+func (s *tusServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Tus-Resumable") != "1.0.0" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	w.Header().Set("Tus-Resumable", "1.0.0")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/files":
+		length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.length, s.metadata = length, r.Header.Get("Upload-Metadata")
+		w.Header().Set("Location", "/files/1")
+		w.WriteHeader(http.StatusCreated)
+	case r.URL.Path != "/files/1":
+		w.WriteHeader(http.StatusNotFound)
+	case r.Method == http.MethodHead:
+		s.heads++
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+		w.Header().Set("Upload-Length", strconv.FormatInt(s.length, 10))
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPatch:
+		s.patches++
+		if s.fault != nil && s.fault(w, r, s.patches) {
+			return
+		}
+		if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		if r.Header.Get("Upload-Offset") != strconv.Itoa(len(s.data)) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		chunk, err := io.ReadAll(r.Body)
+		if err != nil {
+			return
+		}
+		if checksum := r.Header.Get("Upload-Checksum"); checksum != "" {
+			sum := sha1.Sum(chunk)
+			if checksum != "sha1 "+base64.StdEncoding.EncodeToString(sum[:]) {
+				w.WriteHeader(460)
+				return
+			}
+		}
+		s.data = append(s.data, chunk...)
+		w.Header().Set("Upload-Offset", strconv.Itoa(len(s.data)))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func TestUploadTus(t *testing.T) {
+	t.Parallel()
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	type want struct {
+		patches int
+		heads   int
+		err     error
+	}
+	tests := map[string]struct {
+		fault func(s *tusServer, w http.ResponseWriter, r *http.Request, patches int) bool
+		opts  []r2.Option
+		want  want
+	}{
+		"success": {
+			opts: []r2.Option{r2.WithTusChecksum(true)},
+			want: want{patches: 4},
+		},
+		"resume-after-partial-chunk": {
+			fault: func(s *tusServer, w http.ResponseWriter, r *http.Request, patches int) bool {
+				if patches != 2 {
+					return false
+				}
+				// the half of the chunk is stored, and the connection drops.
+				chunk := make([]byte, 128)
+				io.ReadFull(r.Body, chunk)
+				s.data = append(s.data, chunk...)
+				panic(http.ErrAbortHandler)
+			},
+			// the rest of the second chunk is sent from the stored offset.
+			want: want{patches: 5, heads: 1},
+		},
+		"checksum-mismatch-once": {
+			fault: func(_ *tusServer, w http.ResponseWriter, r *http.Request, patches int) bool {
+				if patches != 1 {
+					return false
+				}
+				r.Header.Set("Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(make([]byte, sha1.Size)))
+				return false
+			},
+			opts: []r2.Option{r2.WithTusChecksum(true)},
+			want: want{patches: 5, heads: 1},
+		},
+		"upload-gone": {
+			fault: func(_ *tusServer, w http.ResponseWriter, _ *http.Request, _ int) bool {
+				w.WriteHeader(http.StatusGone)
+				return true
+			},
+			want: want{patches: 1, err: r2.ErrUploadGone},
+		},
+		"give-up": {
+			fault: func(_ *tusServer, w http.ResponseWriter, _ *http.Request, _ int) bool {
+				w.WriteHeader(http.StatusInternalServerError)
+				return true
+			},
+			opts: []r2.Option{r2.WithMaxRequestAttempts(2)},
+			want: want{patches: 3, heads: 2, err: r2.ErrUnexpectedStatusCode},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			s := &tusServer{}
+			if tt.fault != nil {
+				s.fault = func(w http.ResponseWriter, r *http.Request, patches int) bool {
+					return tt.fault(s, w, r, patches)
+				}
+			}
+			ts := httptest.NewServer(s)
+			defer ts.Close()
+
+			var lastDone int64
+			opts := append([]r2.Option{
+				r2.WithInterval(time.Millisecond),
+				r2.WithTusChunkSize(256),
+				r2.WithTusMetadata(map[string]string{"filename": "file.txt", "is_confidential": ""}),
+				r2.WithProgress(func(done, total int64) {
+					lastDone = done
+				}),
+			}, tt.opts...)
+			location, err := r2.UploadTus(context.Background(), ts.URL+"/files", bytes.NewReader(content), int64(len(content)), opts...)
+			if !errors.Is(err, tt.want.err) {
+				t.Fatalf("error got: %v, want: %v", err, tt.want.err)
+			}
+			if location != ts.URL+"/files/1" {
+				t.Errorf("location got: %s, want: %s", location, ts.URL+"/files/1")
+			}
+			if s.patches != tt.want.patches || s.heads != tt.want.heads {
+				t.Errorf("requests got: PATCH %d HEAD %d, want: PATCH %d HEAD %d", s.patches, s.heads, tt.want.patches, tt.want.heads)
+			}
+			if want := "filename " + base64.StdEncoding.EncodeToString([]byte("file.txt")) + ",is_confidential"; s.metadata != want {
+				t.Errorf("metadata got: %s, want: %s", s.metadata, want)
+			}
+			if tt.want.err != nil {
+				return
+			}
+			if !bytes.Equal(s.data, content) {
+				t.Errorf("uploaded got: %q, want: %q", s.data, content)
+			}
+			if lastDone != int64(len(content)) {
+				t.Errorf("progress got: %d, want: %d", lastDone, len(content))
+			}
+		})
+	}
+}
+
+func TestUploadTusWithUploadURL(t *testing.T) {
+	t.Parallel()
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	s := &tusServer{length: int64(len(content)), data: bytes.Clone(content[:300])}
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	opts := []r2.Option{
+		r2.WithTusChunkSize(256),
+		r2.WithTusUploadURL(ts.URL + "/files/1"),
+	}
+	if _, err := r2.UploadTus(context.Background(), ts.URL+"/files", bytes.NewReader(content), int64(len(content)), opts...); err != nil {
+		t.Fatal(err)
+	}
+	if s.heads != 1 || s.patches != 3 {
+		t.Errorf("requests got: PATCH %d HEAD %d, want: PATCH 3 HEAD 1", s.patches, s.heads)
+	}
+	if !bytes.Equal(s.data, content) {
+		t.Errorf("content does not match")
+	}
+}
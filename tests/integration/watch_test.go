@@ -0,0 +1,151 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"github.com/miyamo2/r2"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	modTimes := []time.Time{
+		time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+	}
+	type want struct {
+		bodies   []string
+		requests int32
+	}
+	tests := map[string]struct {
+		// validator sets the validator of the version to the response, and returns true if the request is not modified.
+		validator func(w http.ResponseWriter, r *http.Request, version int) bool
+		opts      []r2.Option
+		want      want
+	}{
+		"etag": {
+			validator: func(w http.ResponseWriter, r *http.Request, version int) bool {
+				etag := []string{`"v1"`, `"v2"`}[version]
+				w.Header().Set("ETag", etag)
+				return r.Header.Get("If-None-Match") == etag
+			},
+			want: want{bodies: []string{"v1", "v2"}, requests: 4},
+		},
+		"last-modified": {
+			validator: func(w http.ResponseWriter, r *http.Request, version int) bool {
+				w.Header().Set("Last-Modified", modTimes[version].Format(http.TimeFormat))
+				since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+				return err == nil && !modTimes[version].After(since)
+			},
+			want: want{bodies: []string{"v1", "v2"}, requests: 4},
+		},
+		"body-hash": {
+			validator: func(_ http.ResponseWriter, _ *http.Request, _ int) bool {
+				return false
+			},
+			want: want{bodies: []string{"v1", "v2"}, requests: 4},
+		},
+		"long-poll": {
+			validator: func(w http.ResponseWriter, r *http.Request, version int) bool {
+				if r.URL.Query().Get("wait") != "30s" {
+					w.WriteHeader(http.StatusBadRequest)
+					return true
+				}
+				etag := []string{`"v1"`, `"v2"`}[version]
+				w.Header().Set("ETag", etag)
+				return r.Header.Get("If-None-Match") == etag
+			},
+			opts: []r2.Option{r2.WithLongPoll("wait", 30*time.Second)},
+			want: want{bodies: []string{"v1", "v2"}, requests: 4},
+		},
+		"transient-error": {
+			validator: func(w http.ResponseWriter, r *http.Request, version int) bool {
+				etag := []string{`"v1"`, `"v2"`}[version]
+				w.Header().Set("ETag", etag)
+				return r.Header.Get("If-None-Match") == etag
+			},
+			opts: []r2.Option{r2.WithMaxRequestAttempts(1)},
+			want: want{bodies: []string{"v1", "v2"}, requests: 4},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			var requests atomic.Int32
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := requests.Add(1)
+				// the representation is changed at the 4th request.
+				version := 0
+				if n >= 4 {
+					version = 1
+				}
+				if name == "transient-error" && n == 2 {
+					w.WriteHeader(http.StatusServiceUnavailable)
+					return
+				}
+				if tt.validator(w, r, version) {
+					if w.Header().Get("ETag") != "" || w.Header().Get("Last-Modified") != "" {
+						w.WriteHeader(http.StatusNotModified)
+					}
+					return
+				}
+				io.WriteString(w, []string{"v1", "v2"}[version])
+			})
+			ts := httptest.NewServer(h)
+			defer ts.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			opts := append([]r2.Option{r2.WithInterval(time.Millisecond)}, tt.opts...)
+			var (
+				bodies []string
+				errs   int
+			)
+			for res, err := range r2.Watch(ctx, ts.URL, time.Millisecond, opts...) {
+				if err != nil {
+					errs++
+					continue
+				}
+				b, err := io.ReadAll(res.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				bodies = append(bodies, string(b))
+				if len(bodies) == len(tt.want.bodies) {
+					break
+				}
+			}
+			if !slices.Equal(bodies, tt.want.bodies) {
+				t.Errorf("bodies got: %q, want: %q", bodies, tt.want.bodies)
+			}
+			if got := requests.Load(); got != tt.want.requests {
+				t.Errorf("requests got: %d, want: %d", got, tt.want.requests)
+			}
+			if wantErrs := map[bool]int{true: 1}[name == "transient-error"]; errs != wantErrs {
+				t.Errorf("errors got: %d, want: %d", errs, wantErrs)
+			}
+		})
+	}
+}
+
+func TestWatchWithInvalidURL(t *testing.T) {
+	t.Parallel()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	var errs []error
+	for _, err := range r2.Watch(ctx, "http://example.com/%zz", time.Millisecond) {
+		errs = append(errs, err)
+	}
+	// the request that can not be created is never polled again.
+	var urlErr *url.Error
+	if len(errs) != 1 || !errors.As(errs[0], &urlErr) {
+		t.Errorf("errors got: %v, want: one *url.Error", errs)
+	}
+}
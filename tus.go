@@ -0,0 +1,256 @@
+package r2
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUploadGone is returned when the tus upload is not found or expired on the server.
+// The upload must be created again.
+var ErrUploadGone = errors.New("r2: upload is not found or expired")
+
+// tus 1.0 protocol headers.
+const (
+	headerKeyTusResumable  = "Tus-Resumable"
+	headerKeyUploadLength  = "Upload-Length"
+	headerKeyUploadOffset  = "Upload-Offset"
+	headerKeyUploadMeta    = "Upload-Metadata"
+	headerKeyUploadCheck   = "Upload-Checksum"
+	tusVersion             = "1.0.0"
+	contentTypeOffsetOctet = "application/offset+octet-stream"
+)
+
+// WithTusChunkSize sets the size of the chunk sent by each PATCH request of [UploadTus].
+// Default: 4MiB
+func WithTusChunkSize(size int64) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetTusChunkSize(size)
+	}
+}
+
+// WithTusMetadata sets 'Upload-Metadata' of the upload created by [UploadTus].
+func WithTusMetadata(metadata map[string]string) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetTusMetadata(metadata)
+	}
+}
+
+// WithTusChecksum sets whether [UploadTus] sends each chunk with 'Upload-Checksum' of SHA-1 in the checksum extension.
+// Default: false
+func WithTusChecksum(checksum bool) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetTusChecksum(checksum)
+	}
+}
+
+// WithTusUploadURL sets the url of the upload that [UploadTus] resumes instead of creating a new one.
+func WithTusUploadURL(url string) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetTusUploadURL(url)
+	}
+}
+
+// UploadTus uploads size bytes of body with the tus 1.0 resumable upload protocol, and returns the url of the upload.
+//
+// The upload is created with POST to endpoint same as [Post] unless [WithTusUploadURL] is specified,
+// and body is sent with PATCH by the chunks of the size specified in [WithTusChunkSize].
+// When the chunk fails, the offset on the server is queried with HEAD same as [Head],
+// and the upload resumes from it after waiting for the interval or the exponential backoff.
+// The aggregate progress is reported by [WithProgress].
+//
+// The upload is given up when the chunk fails without progress more than the maximum number of requests specified in [WithMaxRequestAttempts],
+// or exceeds the deadline for the [context.Context] passed in the argument.
+// If the upload is not found or expired on the server, [ErrUploadGone] is returned.
+func UploadTus(ctx context.Context, endpoint string, body io.ReaderAt, size int64, options ...internal.Option) (string, error) {
+	prop := internal.NewR2Prop(options...)
+	options = append(slices.Clip(options), WithAutoCloseResponseBody(false))
+
+	location := prop.TusUploadURL()
+	var (
+		offset int64
+		err    error
+	)
+	if location == "" {
+		location, err = createTusUpload(ctx, prop, endpoint, size, options...)
+	} else {
+		offset, err = tusOffset(ctx, location, options...)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	progress := prop.Progress()
+	if progress != nil {
+		progress(offset, size)
+	}
+	chunkSize := prop.TusChunkSize()
+	patchOptions := append(slices.Clip(options), WithMaxRequestAttempts(1), WithContentType(contentTypeOffsetOctet))
+	for resumes := 0; offset < size; {
+		n := min(chunkSize, size-offset)
+		next, err := patchTusChunk(ctx, location, io.NewSectionReader(body, offset, n), offset, prop.TusChecksum(), patchOptions...)
+		if err == nil && next > offset {
+			offset, resumes = next, 0
+			if progress != nil {
+				progress(offset, size)
+			}
+			continue
+		}
+		if errors.Is(err, ErrUploadGone) {
+			return location, err
+		}
+		if err == nil {
+			err = fmt.Errorf("%w: upload-offset is not advanced", ErrUnexpectedStatusCode)
+		}
+
+		resumes++
+		if ctx.Err() != nil || (prop.MaxRequestTimes() != 0 && resumes > prop.MaxRequestTimes()) {
+			return location, err
+		}
+		slog.Default().WarnContext(
+			ctx,
+			"[r2]: tus chunk upload failed.",
+			slog.String("url", location),
+			slog.Int64("offset", offset),
+			slog.Any("error", err))
+		wait := prop.Interval()
+		if wait == 0 {
+			wait = backOff(resumes - 1)
+		}
+		select {
+		case <-ctx.Done():
+			slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
+			return location, ctx.Err()
+		case <-time.After(wait):
+			// no-op
+		}
+		current, err := tusOffset(ctx, location, options...)
+		if err != nil {
+			return location, err
+		}
+		if current > offset {
+			// the part of the chunk is stored on the server.
+			resumes = 0
+		}
+		offset = current
+		if progress != nil {
+			progress(offset, size)
+		}
+	}
+	return location, nil
+}
+
+// createTusUpload creates the upload with POST, and returns its url.
+func createTusUpload(ctx context.Context, prop internal.R2Prop, endpoint string, size int64, options ...internal.Option) (string, error) {
+	metadata := tusMetadata(prop.TusMetadata())
+	res, err := connectStream(ctx, func(_ int) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(headerKeyTusResumable, tusVersion)
+		req.Header.Set(headerKeyUploadLength, strconv.FormatInt(size, 10))
+		if metadata != "" {
+			req.Header.Set(headerKeyUploadMeta, metadata)
+		}
+		return req, nil
+	}, options...)
+	if err != nil {
+		return "", err
+	}
+	res.Body.Close()
+	location := res.Header.Get(internal.ResponseHeaderKeyLocation)
+	if res.StatusCode != http.StatusCreated || location == "" {
+		return "", fmt.Errorf("%w: %s, location: %q", ErrUnexpectedStatusCode, res.Status, location)
+	}
+	return resolveLocation(res, location)
+}
+
+// tusOffset queries the offset of the upload with HEAD.
+func tusOffset(ctx context.Context, location string, options ...internal.Option) (int64, error) {
+	return tusRequest(ctx, func(_ int) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, location, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(headerKeyTusResumable, tusVersion)
+		req.Header.Set("Cache-Control", "no-store")
+		return req, nil
+	}, options...)
+}
+
+// patchTusChunk sends the chunk at offset with PATCH, and returns the offset after the chunk.
+func patchTusChunk(ctx context.Context, location string, chunk *io.SectionReader, offset int64, checksum bool, options ...internal.Option) (int64, error) {
+	var digest string
+	if checksum {
+		h := sha1.New()
+		if _, err := io.Copy(h, io.NewSectionReader(chunk, 0, chunk.Size())); err != nil {
+			return 0, err
+		}
+		digest = "sha1 " + base64.StdEncoding.EncodeToString(h.Sum(nil))
+	}
+	return tusRequest(ctx, func(_ int) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPatch, location, io.NewSectionReader(chunk, 0, chunk.Size()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set(headerKeyTusResumable, tusVersion)
+		req.Header.Set(headerKeyUploadOffset, strconv.FormatInt(offset, 10))
+		if digest != "" {
+			req.Header.Set(headerKeyUploadCheck, digest)
+		}
+		return req, nil
+	}, options...)
+}
+
+// tusRequest sends the requests created by newRequest same as [DoFunc],
+// and returns 'Upload-Offset' of the last response.
+func tusRequest(ctx context.Context, newRequest func(attempt int) (*http.Request, error), options ...internal.Option) (int64, error) {
+	res, err := lastResponse(ctx, newRequest, options...)
+	if err != nil {
+		return 0, err
+	}
+	if res.Body != nil {
+		res.Body.Close()
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return 0, fmt.Errorf("%w: %s", ErrUploadGone, res.Status)
+	case res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices:
+		return 0, fmt.Errorf("%w: %s", ErrUnexpectedStatusCode, res.Status)
+	}
+	offset, err := strconv.ParseInt(res.Header.Get(headerKeyUploadOffset), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: upload-offset: %w", ErrUnexpectedStatusCode, err)
+	}
+	return offset, nil
+}
+
+// tusMetadata returns the value of 'Upload-Metadata' header.
+// The pairs are sorted by the key, so that the header is stable.
+func tusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	pairs := make([]string, 0, len(metadata))
+	for _, key := range keys {
+		pair := key
+		if value := metadata[key]; value != "" {
+			pair += " " + base64.StdEncoding.EncodeToString([]byte(value))
+		}
+		pairs = append(pairs, pair)
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,157 @@
+package r2
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/miyamo2/r2/internal"
+	"io"
+	"iter"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+)
+
+// WithLongPoll sets the query parameter and the duration that the server holds the request of [Watch].
+// For example, WithLongPoll("wait", 30*time.Second) adds '?wait=30s' to the url.
+// The period specified in [WithPeriod] must be longer than wait.
+func WithLongPoll(param string, wait time.Duration) internal.Option {
+	return func(p *internal.R2Prop) {
+		p.SetLongPoll(param, wait)
+	}
+}
+
+// Watch polls url with GET same as [Get] at the interval, and yields the response only when the representation is changed.
+//
+// Each poll is the conditional request with 'If-None-Match' and 'If-Modified-Since' of the last response,
+// and 304(Not Modified) is regarded as no change without yielding.
+// The representation is compared by 'ETag', 'Last-Modified' or the hash of the body if the server sends neither of them.
+// The first response is always yielded.
+// The interval is overridden by 'Retry-After' header of the response.
+//
+// Each poll is retried same as [Get], and the error of the poll that is not recovered by the retries is yielded.
+// The watch continues until exceeds the deadline for the [context.Context] passed in the argument,
+// or the for range loop is interrupted by break.
+func Watch(ctx context.Context, url string, interval time.Duration, options ...internal.Option) iter.Seq2[*http.Response, error] {
+	prop := internal.NewR2Prop(options...)
+	return func(yield func(*http.Response, error) bool) {
+		// the response is closed after it is yielded, if necessary.
+		options := append(slices.Clip(options), WithAutoCloseResponseBody(false))
+		autoClose := prop.AutoCloseResponseBody()
+
+		watchURL, err := longPollURL(url, prop)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		var (
+			etag, lastModified, lastKey string
+			// prepareErr is the error of the request that can not be created, which does not recover by polling.
+			prepareErr error
+		)
+		newRequest := func(_ int) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, watchURL, nil)
+			if err != nil {
+				prepareErr = err
+				return nil, err
+			}
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			if lastModified != "" {
+				req.Header.Set("If-Modified-Since", lastModified)
+			}
+			return req, nil
+		}
+		for {
+			res, err := lastResponse(ctx, newRequest, options...)
+			wait := interval
+			switch {
+			case prepareErr != nil:
+				yield(nil, prepareErr)
+				return
+			case err != nil:
+				if ctx.Err() != nil {
+					return
+				}
+				if !yield(nil, err) {
+					return
+				}
+			case res.StatusCode == http.StatusNotModified:
+				res.Body.Close()
+				wait = pollWait(res, interval)
+			case res.StatusCode < http.StatusOK || res.StatusCode >= http.StatusMultipleChoices:
+				res.Body.Close()
+				wait = pollWait(res, interval)
+				if !yield(nil, fmt.Errorf("%w: %s", ErrUnexpectedStatusCode, res.Status)) {
+					return
+				}
+			default:
+				wait = pollWait(res, interval)
+				key, err := representationKey(res)
+				if err != nil {
+					res.Body.Close()
+					if !yield(nil, err) {
+						return
+					}
+					break
+				}
+				etag, lastModified = res.Header.Get("ETag"), res.Header.Get("Last-Modified")
+				if key == lastKey {
+					// the server does not support the conditional request, but the representation is not changed.
+					res.Body.Close()
+					break
+				}
+				lastKey = key
+				if !yieldWithAutoClose(res, nil, autoClose, yield) {
+					return
+				}
+			}
+			select {
+			case <-ctx.Done():
+				slog.WarnContext(ctx, "[r2]: interrupted by context done.", slog.Any("error", ctx.Err()))
+				return
+			case <-time.After(wait):
+				// no-op
+			}
+		}
+	}
+}
+
+// longPollURL returns the url with the long-poll query parameter specified in [WithLongPoll].
+func longPollURL(rawURL string, prop internal.R2Prop) (string, error) {
+	param, wait := prop.LongPoll()
+	if param == "" {
+		return rawURL, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	return withQuery(u, param, wait.String()), nil
+}
+
+// representationKey returns the key that identifies the representation of the response.
+// If the response has neither 'ETag' nor 'Last-Modified', the body is buffered and hashed.
+func representationKey(res *http.Response) (string, error) {
+	if etag := res.Header.Get("ETag"); etag != "" {
+		return "etag:" + etag, nil
+	}
+	if lastModified := res.Header.Get("Last-Modified"); lastModified != "" {
+		return "last-modified:" + lastModified, nil
+	}
+	copied, err := bufferResponseBody(res)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if copied.Body != nil {
+		if _, err := io.Copy(h, copied.Body); err != nil {
+			return "", err
+		}
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}